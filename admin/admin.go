@@ -0,0 +1,116 @@
+// Package admin provides an HTTP API to inspect and control a running proxy.
+package admin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/plamorg/voltproxy/metrics"
+	"github.com/plamorg/voltproxy/middlewares"
+	"github.com/plamorg/voltproxy/services"
+)
+
+var (
+	errMissingAddress = fmt.Errorf("admin API requires an address")
+	errMissingToken   = fmt.Errorf("admin API requires a token")
+)
+
+// defaultAllowedIPs are the addresses allowed to access the admin API if none are given.
+var defaultAllowedIPs = []string{"127.0.0.1", "::1"}
+
+// Info describes the admin API.
+type Info struct {
+	// Address is the address the admin API listens on, e.g. 127.0.0.1:9000.
+	Address string `yaml:"address"`
+	// Token must be sent as a bearer token in the Authorization header of every request except /ping.
+	Token string `yaml:"token"`
+	// AllowedIPs are the IP addresses, in CIDR notation or not, that may access the admin API.
+	// Defaults to the loopback addresses.
+	AllowedIPs []string `yaml:"allowedIPs"`
+}
+
+// Server serves the admin API. It is separate from the proxy and should be served on its own listener.
+type Server struct {
+	Info
+
+	registry *services.Registry
+	reload   func() error
+	certs    autocert.Cache
+	handler  http.Handler
+}
+
+// New creates an admin API for the services of the registry.
+// The reload function reloads the configuration, replacing the services of the registry.
+// The expiry of TLS certificates is looked up in the certificate cache, if any.
+func New(info Info, registry *services.Registry, reload func() error, certs autocert.Cache) (*Server, error) {
+	if info.Address == "" {
+		return nil, errMissingAddress
+	}
+	if info.Token == "" {
+		return nil, errMissingToken
+	}
+	if info.AllowedIPs == nil {
+		info.AllowedIPs = defaultAllowedIPs
+	}
+	s := &Server{Info: info, registry: registry, reload: reload, certs: certs}
+
+	mux := http.NewServeMux()
+	// Container health checks cannot always send a token, so /ping only requires an allowed address.
+	// Likewise, the dashboard holds no data and asks for the token to call the API.
+	mux.HandleFunc("/ping", s.ping)
+	mux.Handle("/", allow(http.MethodGet, s.dashboard))
+	mux.Handle("/services", s.authorize(allow(http.MethodGet, s.listServices)))
+	mux.Handle("/health", s.authorize(allow(http.MethodGet, s.showHealth)))
+	mux.Handle("/drain", s.authorize(allow(http.MethodPost, s.drain)))
+	mux.Handle("/enable", s.authorize(allow(http.MethodPost, s.enable)))
+	mux.Handle("/reload", s.authorize(allow(http.MethodPost, s.reloadConfig)))
+	mux.Handle("/canary/restart", s.authorize(allow(http.MethodPost, s.restartCanary)))
+	mux.Handle("/log/level", s.authorize(http.HandlerFunc(s.logLevel)))
+	mux.Handle("/metrics", s.authorize(allow(http.MethodGet, metrics.Handler(metrics.Default, s.newMetrics()).ServeHTTP)))
+	mux.Handle("/debug/pprof/", s.authorize(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", s.authorize(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", s.authorize(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", s.authorize(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", s.authorize(http.HandlerFunc(pprof.Trace)))
+	s.handler = middlewares.NewIPAllow(info.AllowedIPs).Handle(mux)
+	return s, nil
+}
+
+// ServeHTTP serves a request to the admin API from an allowed address.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// authorize only lets requests with the admin token through.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			slog.Warn("Unauthorized admin request",
+				slog.String("remoteAddr", r.RemoteAddr),
+				slog.String("path", r.URL.Path))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow only lets requests with the given method through.
+func allow(method string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		next(w, r)
+	})
+}
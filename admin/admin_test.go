@@ -0,0 +1,381 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/plamorg/voltproxy/logging"
+	"github.com/plamorg/voltproxy/middlewares"
+	"github.com/plamorg/voltproxy/services"
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+const testToken = "secret"
+
+func newTestServer(t *testing.T, host string, reload func() error) (*Server, *services.LoadBalancer) {
+	t.Helper()
+	foo := &services.Service{
+		Name:   "foo",
+		Health: health.Always(true),
+		Router: services.NewRedirect(url.URL{Scheme: "http", Host: "foo.internal"}),
+	}
+	bar := &services.Service{
+		Name:   "bar",
+		Health: health.Always(false),
+		Router: services.NewRedirect(url.URL{Scheme: "http", Host: "bar.internal"}),
+	}
+	lb := services.NewLoadBalancer(host, &services.Failover{}, []*services.Service{foo, bar},
+		services.LoadBalancerOptions{})
+	registry := services.NewRegistry(map[string]*services.Service{
+		"foo.example.com": foo,
+		"bar.example.com": bar,
+		host: {
+			Name:   "lb",
+			Health: health.NewGroup(health.Info{}, health.Policy{}, lb.Members()),
+			Router: lb,
+		},
+	})
+	server, err := New(Info{Address: "127.0.0.1:0", Token: testToken}, registry, reload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, lb
+}
+
+func request(server *Server, method, target, token, remoteAddr string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = remoteAddr
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string]struct {
+		info     Info
+		expected error
+	}{
+		"missing address": {info: Info{Token: testToken}, expected: errMissingAddress},
+		"missing token":   {info: Info{Address: ":9000"}, expected: errMissingToken},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(test.info, services.NewRegistry(nil), nil, nil); !errors.Is(err, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestServerAccess(t *testing.T) {
+	server, _ := newTestServer(t, "access.example.com", nil)
+	local, local6, remote := "127.0.0.1:1234", "[::1]:1234", "192.0.2.1:1234"
+
+	tests := map[string]struct {
+		method     string
+		target     string
+		token      string
+		remoteAddr string
+		expected   int
+	}{
+		"ping":                {target: "/ping", remoteAddr: local, expected: http.StatusOK},
+		"ping not allowed":    {target: "/ping", remoteAddr: remote, expected: http.StatusForbidden},
+		"no token":            {target: "/services", remoteAddr: local6, expected: http.StatusUnauthorized},
+		"wrong token":         {target: "/services", token: "wrong", remoteAddr: local6, expected: http.StatusUnauthorized},
+		"token":               {target: "/services", token: testToken, remoteAddr: local6, expected: http.StatusOK},
+		"token not allowed":   {target: "/services", token: testToken, remoteAddr: remote, expected: http.StatusForbidden},
+		"pprof":               {target: "/debug/pprof/", token: testToken, remoteAddr: local, expected: http.StatusOK},
+		"pprof without token": {target: "/debug/pprof/", remoteAddr: local, expected: http.StatusUnauthorized},
+		"wrong method": {
+			method:     http.MethodPost,
+			target:     "/services",
+			token:      testToken,
+			remoteAddr: local,
+			expected:   http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := request(server, method, test.target, test.token, test.remoteAddr)
+			if w.Code != test.expected {
+				t.Errorf("expected status code %d, got %d", test.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestServerListServices(t *testing.T) {
+	server, _ := newTestServer(t, "list.example.com", nil)
+
+	w := request(server, http.MethodGet, "/services", testToken, "127.0.0.1:1234")
+	var infos []serviceInfo
+	if err := json.NewDecoder(w.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedHosts := []string{"bar.example.com", "foo.example.com", "list.example.com"}
+	if len(infos) != len(expectedHosts) {
+		t.Fatalf("expected %d services, got %d", len(expectedHosts), len(infos))
+	}
+	for i, info := range infos {
+		if info.Host != expectedHosts[i] {
+			t.Errorf("expected host %s, got %s", expectedHosts[i], info.Host)
+		}
+	}
+	if infos[1].Type != typeRedirect || infos[1].Route != "http://foo.internal" {
+		t.Errorf("expected foo to redirect to http://foo.internal, got %+v", infos[1])
+	}
+	lb := infos[2]
+	if lb.Type != typeLoadBalancer || len(lb.Members) != 2 || lb.Members[1].Route != "http://bar.internal" {
+		t.Errorf("expected load balancer with foo and bar, got %+v", lb)
+	}
+}
+
+func TestServerListServicesDetails(t *testing.T) {
+	cache := autocert.DirCache(t.TempDir())
+	notAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cacheCertificate(t, cache, "tls.example.com", notAfter)
+	registry := services.NewRegistry(map[string]*services.Service{
+		"tls.example.com": {
+			Name:        "tls",
+			TLS:         true,
+			Middlewares: []middlewares.Middleware{middlewares.NewIPAllow(nil), &middlewares.XForward{}},
+			Health:      health.Always(true),
+			Router:      services.NewRedirect(url.URL{Scheme: "http", Host: "tls.internal"}),
+		},
+	})
+	server, err := New(Info{Address: "127.0.0.1:0", Token: testToken}, registry, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := request(server, http.MethodGet, "/services", testToken, "127.0.0.1:1234")
+	var infos []serviceInfo
+	if err := json.NewDecoder(w.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected %d services, got %d", 1, len(infos))
+	}
+	if expected := []string{"ipAllow", "xForward"}; !slices.Equal(infos[0].Middlewares, expected) {
+		t.Errorf("expected middlewares %v, got %v", expected, infos[0].Middlewares)
+	}
+	if expiry := infos[0].CertificateExpiry; expiry == nil || !expiry.Equal(notAfter) {
+		t.Errorf("expected certificate expiry %v, got %v", notAfter, expiry)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	cache := autocert.DirCache(t.TempDir())
+	notAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cacheCertificate(t, cache, "metrics.example.com", notAfter)
+	foo := &services.Service{
+		Name:   "foo",
+		Health: health.Always(true),
+		Router: services.NewRedirect(url.URL{Scheme: "http", Host: "foo.internal"}),
+	}
+	lb := services.NewLoadBalancer("metrics.example.com", &services.Failover{}, []*services.Service{foo},
+		services.LoadBalancerOptions{})
+	registry := services.NewRegistry(map[string]*services.Service{
+		"metrics.example.com": {Name: "lb", TLS: true, Health: health.Always(false), Router: lb},
+	})
+	server, err := New(Info{Address: "127.0.0.1:0", Token: testToken}, registry, nil, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := request(server, http.MethodGet, "/metrics", "", "127.0.0.1:1234"); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	w := request(server, http.MethodGet, "/metrics", testToken, "127.0.0.1:1234")
+	for _, expected := range []string{
+		`voltproxy_service_up{host="metrics.example.com",service="lb",member=""} 0`,
+		`voltproxy_service_up{host="metrics.example.com",service="lb",member="foo"} 1`,
+		`voltproxy_certificate_expiry_timestamp_seconds{host="metrics.example.com"} ` +
+			strconv.FormatFloat(float64(notAfter.Unix()), 'g', -1, 64),
+		"# TYPE voltproxy_requests_total counter",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected metrics to contain %s, got %s", expected, w.Body.String())
+		}
+	}
+}
+
+func TestServerDashboard(t *testing.T) {
+	server, _ := newTestServer(t, "dashboard.example.com", nil)
+
+	w := request(server, http.MethodGet, "/", "", "127.0.0.1:1234")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<title>voltproxy</title>") {
+		t.Errorf("expected dashboard, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("expected HTML, got %s", contentType)
+	}
+	if w := request(server, http.MethodGet, "/unknown", "", "127.0.0.1:1234"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := request(server, http.MethodGet, "/", "", "192.0.2.1:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestServerHealth(t *testing.T) {
+	server, _ := newTestServer(t, "health.example.com", nil)
+
+	w := request(server, http.MethodGet, "/health", testToken, "127.0.0.1:1234")
+	var infos []healthInfo
+	if err := json.NewDecoder(w.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("expected %d services, got %d", 3, len(infos))
+	}
+	if bar := infos[0]; bar.Up || bar.State != health.StateDown {
+		t.Errorf("expected bar to be down, got %+v", bar)
+	}
+	if lb := infos[2]; len(lb.Members) != 2 || !lb.Members[0].Up || lb.Members[1].Up {
+		t.Errorf("expected load balancer with foo up and bar down, got %+v", lb)
+	}
+
+	w = request(server, http.MethodGet, "/health?host=foo.example.com", testToken, "127.0.0.1:1234")
+	var info healthInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Host != "foo.example.com" || !info.Up {
+		t.Errorf("expected foo to be up, got %+v", info)
+	}
+
+	w = request(server, http.MethodGet, "/health?host=baz.example.com", testToken, "127.0.0.1:1234")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServerDrain(t *testing.T) {
+	server, lb := newTestServer(t, "drain-admin.example.com", nil)
+
+	tests := []struct {
+		target   string
+		expected int
+		drained  bool
+	}{
+		{target: "/drain?host=drain-admin.example.com&service=foo", expected: http.StatusNoContent, drained: true},
+		{target: "/enable?host=drain-admin.example.com&service=foo", expected: http.StatusNoContent},
+		{target: "/drain?host=drain-admin.example.com&service=baz", expected: http.StatusNotFound},
+		{target: "/drain?host=unknown.example.com&service=foo", expected: http.StatusNotFound},
+		{target: "/drain?host=foo.example.com&service=foo", expected: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := request(server, http.MethodPost, test.target, testToken, "127.0.0.1:1234")
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status code %d, got %d", test.target, test.expected, w.Code)
+		}
+		if lb.Drained("foo") != test.drained {
+			t.Errorf("%s: expected foo drained %v, got %v", test.target, test.drained, lb.Drained("foo"))
+		}
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	reloads := 0
+	var reloadErr error
+	server, _ := newTestServer(t, "reload-admin.example.com", func() error {
+		reloads++
+		return reloadErr
+	})
+
+	if w := request(server, http.MethodPost, "/reload", testToken, "127.0.0.1:1234"); w.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, w.Code)
+	}
+	reloadErr = fmt.Errorf("invalid config")
+	w := request(server, http.MethodPost, "/reload", testToken, "127.0.0.1:1234")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if reloads != 2 {
+		t.Errorf("expected %d reloads, got %d", 2, reloads)
+	}
+}
+
+func TestServerLogLevel(t *testing.T) {
+	server, _ := newTestServer(t, "log-admin.example.com", nil)
+	defer func() { _ = logging.SetLevel("info") }()
+
+	tests := []struct {
+		method        string
+		target        string
+		expected      int
+		expectedLevel string
+	}{
+		{method: http.MethodGet, target: "/log/level", expected: http.StatusOK, expectedLevel: "info"},
+		{method: http.MethodPost, target: "/log/level?level=debug", expected: http.StatusOK, expectedLevel: "debug"},
+		{method: http.MethodPost, target: "/log/level?level=invalid", expected: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/log/level", expected: http.StatusBadRequest},
+		{method: http.MethodPut, target: "/log/level?level=warn", expected: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, target: "/log/level", expected: http.StatusOK, expectedLevel: "debug"},
+	}
+	for _, test := range tests {
+		w := request(server, test.method, test.target, testToken, "127.0.0.1:1234")
+		if w.Code != test.expected {
+			t.Fatalf("%s %s: expected status code %d, got %d", test.method, test.target, test.expected, w.Code)
+		}
+		if test.expectedLevel == "" {
+			continue
+		}
+		var info levelInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatal(err)
+		}
+		if info.Level != test.expectedLevel {
+			t.Errorf("%s %s: expected level %s, got %s", test.method, test.target, test.expectedLevel, info.Level)
+		}
+	}
+}
+
+func TestServerRestartCanary(t *testing.T) {
+	server, _ := newTestServer(t, "canary-admin.example.com", nil)
+	pool := []*services.Service{
+		{Name: "stable", Health: health.Always(true)},
+		{Name: "canary", Health: health.Always(true)},
+	}
+	canary := services.NewLoadBalancer("rollout-admin.example.com", &services.RoundRobin{}, pool,
+		services.LoadBalancerOptions{Canary: &services.Canary{Service: "canary"}})
+	server.registry.Services()["rollout-admin.example.com"] = &services.Service{Name: "rollout", Router: canary}
+
+	tests := []struct {
+		target   string
+		expected int
+	}{
+		{target: "/canary/restart?host=rollout-admin.example.com", expected: http.StatusNoContent},
+		{target: "/canary/restart?host=canary-admin.example.com", expected: http.StatusNotFound},
+		{target: "/canary/restart?host=unknown.example.com", expected: http.StatusNotFound},
+		{target: "/canary/restart?host=foo.example.com", expected: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := request(server, http.MethodPost, test.target, testToken, "127.0.0.1:1234")
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status code %d, got %d", test.target, test.expected, w.Code)
+		}
+	}
+}
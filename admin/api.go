@@ -0,0 +1,342 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/plamorg/voltproxy/logging"
+	"github.com/plamorg/voltproxy/middlewares"
+	"github.com/plamorg/voltproxy/services"
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+var (
+	errServiceNotFound = fmt.Errorf("no service with host")
+	errNotLoadBalancer = fmt.Errorf("service is not a load balancer")
+	errMissingLevel    = fmt.Errorf("missing level")
+)
+
+// Router types.
+const (
+	typeRedirect     = "redirect"
+	typeContainer    = "container"
+	typeLoadBalancer = "loadBalancer"
+	typeUnknown      = "unknown"
+)
+
+// serviceInfo describes a service and the route it resolves to.
+type serviceInfo struct {
+	Host        string   `json:"host,omitempty"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Middlewares []string `json:"middlewares,omitempty"`
+	TLS         bool     `json:"tls"`
+	// CertificateExpiry is when the certificate of a TLS host expires, if it has one.
+	CertificateExpiry *time.Time    `json:"certificateExpiry,omitempty"`
+	Route             string        `json:"route,omitempty"`
+	Error             string        `json:"error,omitempty"`
+	Drained           bool          `json:"drained,omitempty"`
+	Members           []serviceInfo `json:"members,omitempty"`
+}
+
+// healthInfo describes the health of a service.
+type healthInfo struct {
+	Host       string       `json:"host,omitempty"`
+	Name       string       `json:"name"`
+	Up         bool         `json:"up"`
+	State      health.State `json:"state"`
+	LastChange *time.Time   `json:"lastChange,omitempty"`
+	Uptime     uptimeInfo   `json:"uptime"`
+	LastResult *resultInfo  `json:"lastResult,omitempty"`
+	// Results are the recent results, which are only listed on request.
+	Results []resultInfo `json:"results,omitempty"`
+	Drained bool         `json:"drained,omitempty"`
+	Members []healthInfo `json:"members,omitempty"`
+}
+
+type uptimeInfo struct {
+	Hour float64 `json:"hour"`
+	Day  float64 `json:"day"`
+	Week float64 `json:"week"`
+}
+
+// resultInfo describes the result of a health check.
+type resultInfo struct {
+	Time           time.Time `json:"time"`
+	Up             bool      `json:"up"`
+	Endpoint       string    `json:"endpoint,omitempty"`
+	LatencySeconds float64   `json:"latencySeconds"`
+	StatusCode     int       `json:"statusCode,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// levelInfo describes the log level.
+type levelInfo struct {
+	Level string `json:"level"`
+}
+
+type errorInfo struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Error while writing admin response", slog.Any("error", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorInfo{Error: err.Error()})
+}
+
+func (s *Server) ping(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("pong\n"))
+}
+
+// hosts returns the hosts of the current services in order.
+func hosts(serviceMap map[string]*services.Service) []string {
+	hosts := make([]string, 0, len(serviceMap))
+	for host := range serviceMap {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+func routerType(router services.Router) string {
+	switch router.(type) {
+	case *services.Redirect:
+		return typeRedirect
+	case *services.Container:
+		return typeContainer
+	case *services.LoadBalancer:
+		return typeLoadBalancer
+	default:
+		return typeUnknown
+	}
+}
+
+// describeService describes a service, resolving its route.
+// The members of load balancers are described instead of the route, which depends on the request.
+func describeService(service *services.Service) serviceInfo {
+	info := serviceInfo{Name: service.Name, Type: routerType(service.Router), TLS: service.TLS}
+	for _, middleware := range service.Middlewares {
+		info.Middlewares = append(info.Middlewares, middlewares.Name(middleware))
+	}
+	if target, ok := service.Router.(health.Target); ok {
+		route, err := target.Endpoint()
+		if err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Route = route.String()
+		}
+	}
+	if lb, ok := service.Router.(*services.LoadBalancer); ok {
+		for _, member := range lb.Services() {
+			memberInfo := describeService(member)
+			memberInfo.Drained = lb.Drained(member.Name)
+			info.Members = append(info.Members, memberInfo)
+		}
+	}
+	return info
+}
+
+// listServices lists the services along with their resolved routes and the expiry of their certificates.
+func (s *Server) listServices(w http.ResponseWriter, r *http.Request) {
+	serviceMap := s.registry.Services()
+	infos := make([]serviceInfo, 0, len(serviceMap))
+	for _, host := range hosts(serviceMap) {
+		info := describeService(serviceMap[host])
+		info.Host = host
+		if info.TLS && s.certs != nil {
+			if expiry, err := certificateExpiry(r.Context(), s.certs, host); err == nil {
+				info.CertificateExpiry = &expiry
+			}
+		}
+		infos = append(infos, info)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func describeResult(res health.Result) resultInfo {
+	info := resultInfo{
+		Time:           res.Time,
+		Up:             res.Up,
+		Endpoint:       res.Endpoint,
+		LatencySeconds: res.Latency.Seconds(),
+		StatusCode:     res.StatusCode,
+	}
+	if res.Err != nil {
+		info.Error = res.Err.Error()
+	}
+	return info
+}
+
+// describeHealth describes the health of a checker, listing its recent results if withResults is set.
+func describeHealth(name string, checker health.Checker, withResults bool) healthInfo {
+	history := checker.History()
+	info := healthInfo{
+		Name:  name,
+		Up:    checker.Up(),
+		State: history.State,
+		Uptime: uptimeInfo{
+			Hour: history.Uptime.Hour,
+			Day:  history.Uptime.Day,
+			Week: history.Uptime.Week,
+		},
+	}
+	if !history.LastChange.IsZero() {
+		info.LastChange = &history.LastChange
+	}
+	if len(history.Results) > 0 {
+		last := describeResult(history.Results[len(history.Results)-1])
+		info.LastResult = &last
+	}
+	if withResults {
+		for _, res := range history.Results {
+			info.Results = append(info.Results, describeResult(res))
+		}
+	}
+	return info
+}
+
+// describeServiceHealth describes the health of a service and, for load balancers, of its members.
+func describeServiceHealth(service *services.Service, withResults bool) healthInfo {
+	info := describeHealth(service.Name, service.Health, withResults)
+	if lb, ok := service.Router.(*services.LoadBalancer); ok {
+		members := lb.Members()
+		for i, member := range lb.Services() {
+			memberInfo := describeHealth(member.Name, members[i], withResults)
+			memberInfo.Drained = lb.Drained(member.Name)
+			info.Members = append(info.Members, memberInfo)
+		}
+	}
+	return info
+}
+
+// showHealth shows the health of every service, or of the service of the host query parameter
+// along with its recent results. The results of every service are listed with the results query parameter.
+func (s *Server) showHealth(w http.ResponseWriter, r *http.Request) {
+	serviceMap := s.registry.Services()
+	withResults := r.URL.Query().Has("results")
+	if host := r.URL.Query().Get("host"); host != "" {
+		service, ok := serviceMap[host]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", errServiceNotFound, host))
+			return
+		}
+		info := describeServiceHealth(service, true)
+		info.Host = host
+		writeJSON(w, http.StatusOK, info)
+		return
+	}
+
+	infos := make([]healthInfo, 0, len(serviceMap))
+	for _, host := range hosts(serviceMap) {
+		info := describeServiceHealth(serviceMap[host], withResults)
+		info.Host = host
+		infos = append(infos, info)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// loadBalancer returns the load balancer of the host query parameter.
+func (s *Server) loadBalancer(r *http.Request) (*services.LoadBalancer, error) {
+	host := r.URL.Query().Get("host")
+	service, ok := s.registry.Services()[host]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errServiceNotFound, host)
+	}
+	lb, ok := service.Router.(*services.LoadBalancer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errNotLoadBalancer, host)
+	}
+	return lb, nil
+}
+
+// setDrained drains or enables the service query parameter of the load balancer of the host query parameter.
+func (s *Server) setDrained(w http.ResponseWriter, r *http.Request, drain bool) {
+	lb, err := s.loadBalancer(r)
+	if err == nil {
+		name := r.URL.Query().Get("service")
+		if drain {
+			err = lb.Drain(name)
+		} else {
+			err = lb.Enable(name)
+		}
+	}
+	switch {
+	case errors.Is(err, errNotLoadBalancer):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusNotFound, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// drain stops routing new requests to a service of a load balancer.
+func (s *Server) drain(w http.ResponseWriter, r *http.Request) {
+	s.setDrained(w, r, true)
+}
+
+// enable resumes routing requests to a drained service of a load balancer.
+func (s *Server) enable(w http.ResponseWriter, r *http.Request) {
+	s.setDrained(w, r, false)
+}
+
+// restartCanary restarts the canary rollout of the load balancer of the host query parameter.
+func (s *Server) restartCanary(w http.ResponseWriter, r *http.Request) {
+	lb, err := s.loadBalancer(r)
+	if err == nil {
+		err = lb.RestartCanary()
+	}
+	switch {
+	case errors.Is(err, errNotLoadBalancer):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusNotFound, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// reloadConfig reloads the configuration.
+func (s *Server) reloadConfig(w http.ResponseWriter, _ *http.Request) {
+	if err := s.reload(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logLevel shows the log level, or changes it to the level query parameter.
+func (s *Server) logLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		level := r.URL.Query().Get("level")
+		if level == "" {
+			writeError(w, http.StatusBadRequest, errMissingLevel)
+			return
+		}
+		if err := logging.SetLevel(level); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		slog.Info("Changed log level", slog.String("level", level))
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, levelInfo{Level: logging.LevelName(logging.Level())})
+}
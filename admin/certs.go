@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var errNoCertificate = fmt.Errorf("no certificate in cache entry")
+
+// certificateExpiry returns when the certificate of a host in the certificate cache expires.
+func certificateExpiry(ctx context.Context, cache autocert.Cache, host string) (time.Time, error) {
+	data, err := cache.Get(ctx, host)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// The cache entry holds the private key followed by the certificate chain, leaf first.
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return time.Time{}, errNoCertificate
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cert.NotAfter, nil
+	}
+}
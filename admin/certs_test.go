@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// cacheCertificate stores a self-signed certificate for the host that expires at the given time,
+// in the same format as autocert.
+func cacheCertificate(t *testing.T, cache autocert.Cache, host string, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	if err := cache.Put(context.Background(), host, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	cache := autocert.DirCache(t.TempDir())
+	notAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cacheCertificate(t, cache, "example.com", notAfter)
+	if err := cache.Put(context.Background(), "nocert.example.com", []byte("invalid")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		host        string
+		expected    time.Time
+		expectedErr error
+	}{
+		"certificate":    {host: "example.com", expected: notAfter},
+		"no certificate": {host: "nocert.example.com", expectedErr: errNoCertificate},
+		"not cached":     {host: "missing.example.com", expectedErr: autocert.ErrCacheMiss},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expiry, err := certificateExpiry(context.Background(), cache, test.host)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected %v, got %v", test.expectedErr, err)
+			}
+			if !expiry.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, expiry)
+			}
+		})
+	}
+}
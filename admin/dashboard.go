@@ -0,0 +1,23 @@
+package admin
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardPage is the dashboard, a single page without external assets that calls the admin API.
+//
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// dashboard serves the dashboard page.
+func (s *Server) dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy",
+		"default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	w.Write(dashboardPage)
+}
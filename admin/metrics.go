@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/plamorg/voltproxy/metrics"
+	"github.com/plamorg/voltproxy/services"
+)
+
+// newMetrics creates the metrics that are collected from the current services whenever they are scraped,
+// so that services removed by a reload are no longer reported.
+func (s *Server) newMetrics() *metrics.Registry {
+	r := metrics.NewRegistry()
+	r.NewGaugeFunc("voltproxy_service_up",
+		"Whether a service, or a member of a load balancer if given, is up.",
+		[]string{"host", "service", "member"}, s.collectHealth)
+	r.NewGaugeFunc("voltproxy_certificate_expiry_timestamp_seconds",
+		"When the certificate of a TLS host expires, in seconds since the Unix epoch.",
+		[]string{"host"}, s.collectCertificates)
+	return r
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) collectHealth(emit func(value float64, labelValues ...string)) {
+	for host, service := range s.registry.Services() {
+		emit(boolValue(service.Health.Up()), host, service.Name, "")
+		if lb, ok := service.Router.(*services.LoadBalancer); ok {
+			members := lb.Members()
+			for i, member := range lb.Services() {
+				emit(boolValue(members[i].Up()), host, service.Name, member.Name)
+			}
+		}
+	}
+}
+
+func (s *Server) collectCertificates(emit func(value float64, labelValues ...string)) {
+	if s.certs == nil {
+		return
+	}
+	for host, service := range s.registry.Services() {
+		if !service.TLS {
+			continue
+		}
+		if expiry, err := certificateExpiry(context.Background(), s.certs, host); err == nil {
+			emit(float64(expiry.Unix()), host)
+		}
+	}
+}
@@ -9,16 +9,27 @@ import (
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/plamorg/voltproxy/admin"
 	"github.com/plamorg/voltproxy/logging"
 	"github.com/plamorg/voltproxy/middlewares"
+	"github.com/plamorg/voltproxy/notify"
 	"github.com/plamorg/voltproxy/services/health"
+	"github.com/plamorg/voltproxy/tracing"
 )
 
 var (
-	errInvalidConfig     = fmt.Errorf("invalid config")
-	errMustHaveOneRouter = fmt.Errorf("must have exactly one router")
-	errNoServiceWithName = fmt.Errorf("no service with name")
-	errDuplicateHost     = fmt.Errorf("duplicate host")
+	errInvalidConfig      = fmt.Errorf("invalid config")
+	errMustHaveOneRouter  = fmt.Errorf("must have exactly one router")
+	errNoServiceWithName  = fmt.Errorf("no service with name")
+	errDuplicateHost      = fmt.Errorf("duplicate host")
+	errInvalidSameSite    = fmt.Errorf("invalid sameSite, must be one of: lax, strict, none")
+	errSameSiteNoneSecure = fmt.Errorf("sameSite none requires a secure cookie")
+
+	errInvalidRetryCondition = fmt.Errorf("invalid retry condition, must be one of: dial, timeout")
+	errTiersWithServiceNames = fmt.Errorf("tiers and serviceNames are mutually exclusive")
+	errCanaryNotInPool       = fmt.Errorf("canary is not a service of the load balancer")
+	errInvalidCanarySteps    = fmt.Errorf("canary steps must be increasing shares between 0 and 1")
+	errInvalidHealthPolicy   = fmt.Errorf("health policy must require between 1 and all services")
 )
 
 type containerInfo struct {
@@ -27,10 +38,87 @@ type containerInfo struct {
 	Port    uint16 `yaml:"port"`
 }
 
-type loadBalancerInfo struct {
+type cookieInfo struct {
+	Name     string        `yaml:"name"`
+	Secret   string        `yaml:"secret"`
+	Path     string        `yaml:"path"`
+	Domain   string        `yaml:"domain"`
+	Secure   bool          `yaml:"secure"`
+	SameSite string        `yaml:"sameSite"`
+	MaxAge   time.Duration `yaml:"maxAge"`
+}
+
+const (
+	retryOnDial    = "dial"
+	retryOnTimeout = "timeout"
+)
+
+type retryInfo struct {
+	Attempts    int           `yaml:"attempts"`
+	On          []string      `yaml:"on"`
+	StatusCodes []int         `yaml:"statusCodes"`
+	Methods     []string      `yaml:"methods"`
+	Backoff     time.Duration `yaml:"backoff"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+type outlierDetectionInfo struct {
+	ConsecutiveFailures int           `yaml:"consecutiveFailures"`
+	BaseEjectionTime    time.Duration `yaml:"baseEjectionTime"`
+	MaxEjectionTime     time.Duration `yaml:"maxEjectionTime"`
+}
+
+type queueInfo struct {
+	Size    int           `yaml:"size"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type tierInfo struct {
 	ServiceNames []string `yaml:"serviceNames"`
 	Strategy     string   `yaml:"strategy"`
-	Persistent   bool     `yaml:"persistent"`
+	MinHealthy   int      `yaml:"minHealthy"`
+}
+
+type loadFeedbackInfo struct {
+	Header  string        `yaml:"header"`
+	Damping time.Duration `yaml:"damping"`
+}
+
+type canaryInfo struct {
+	Service         string        `yaml:"service"`
+	Steps           []float64     `yaml:"steps"`
+	Interval        time.Duration `yaml:"interval"`
+	MaxErrorRate    float64       `yaml:"maxErrorRate"`
+	MaxLatencyRatio float64       `yaml:"maxLatencyRatio"`
+	MinRequests     int           `yaml:"minRequests"`
+}
+
+type healthPolicyInfo struct {
+	MinHealthy        int     `yaml:"minHealthy"`
+	MinHealthyPercent float64 `yaml:"minHealthyPercent"`
+}
+
+type hedgingInfo struct {
+	Delay   time.Duration `yaml:"delay"`
+	Budget  float64       `yaml:"budget"`
+	Methods []string      `yaml:"methods"`
+}
+
+type loadBalancerInfo struct {
+	ServiceNames []string    `yaml:"serviceNames"`
+	Tiers        []tierInfo  `yaml:"tiers"`
+	Strategy     string      `yaml:"strategy"`
+	Persistent   bool        `yaml:"persistent"`
+	Cookie       *cookieInfo `yaml:"cookie"`
+	Retry        *retryInfo  `yaml:"retry"`
+
+	OutlierDetection *outlierDetectionInfo `yaml:"outlierDetection"`
+	SlowStart        time.Duration         `yaml:"slowStart"`
+	Queue            *queueInfo            `yaml:"queue"`
+	LoadFeedback     *loadFeedbackInfo     `yaml:"loadFeedback"`
+	Canary           *canaryInfo           `yaml:"canary"`
+	Hedging          *hedgingInfo          `yaml:"hedging"`
+	HealthPolicy     *healthPolicyInfo     `yaml:"healthPolicy"`
 }
 
 type routers struct {
@@ -63,14 +151,19 @@ type serviceConfig map[string]struct {
 	Middlewares *middlewares.Middlewares `yaml:"middlewares"`
 	Health      *health.Info             `yaml:"health"`
 
+	MaxConnections int `yaml:"maxConnections"`
+
 	routers `yaml:",inline"`
 }
 
 // Config represents a listing of services to proxy.
 type Config struct {
-	ServiceConfig serviceConfig  `yaml:"services"`
-	LogConfig     logging.Config `yaml:"log"`
-	ReadTimeout   time.Duration  `yaml:"readTimeout"`
+	ServiceConfig serviceConfig   `yaml:"services"`
+	LogConfig     logging.Config  `yaml:"log"`
+	ReadTimeout   time.Duration   `yaml:"readTimeout"`
+	Notifiers     []notify.Info   `yaml:"notifiers"`
+	Admin         *admin.Info     `yaml:"admin"`
+	Tracing       *tracing.Config `yaml:"tracing"`
 }
 
 // New parses the given YAML data into a Config.
@@ -84,6 +177,22 @@ func New(data []byte) (*Config, error) {
 	return &config, nil
 }
 
+// Notifier returns the notifier of service state changes, or nil if no notifiers are configured.
+func (c *Config) Notifier() (notify.Notifier, error) {
+	if len(c.Notifiers) == 0 {
+		return nil, nil
+	}
+	notifiers := make(notify.Multi, 0, len(c.Notifiers))
+	for _, info := range c.Notifiers {
+		notifier, err := notify.New(info)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidConfig, err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
 // TLSHosts returns a list of hosts that require TLS.
 func (c *Config) TLSHosts() []string {
 	var hosts []string
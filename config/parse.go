@@ -1,8 +1,13 @@
 package config
 
 import (
+	"crypto/rand"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"net/url"
+	"slices"
+	"sync"
 
 	"github.com/plamorg/voltproxy/dockerapi"
 	"github.com/plamorg/voltproxy/services"
@@ -23,11 +28,178 @@ func uniqueHosts(conf serviceConfig) bool {
 	return true
 }
 
-func createHealthChecker(info *health.Info) health.Checker {
+func createHealthChecker(info *health.Info) (health.Checker, error) {
 	if info == nil {
-		return health.Always(true)
+		return health.Always(true), nil
 	}
-	return health.New(*info)
+	return health.NewChecker(*info)
+}
+
+const persistenceKeyLength = 32
+
+func sameSiteFromString(sameSite string) (http.SameSite, error) {
+	switch sameSite {
+	case "":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("%w: got %s", errInvalidSameSite, sameSite)
+	}
+}
+
+// generatedKeys are the persistence keys generated for load balancers without a cookie secret, by service name.
+// They are kept across reloads so that the cookies of clients stay valid until a restart.
+var generatedKeys = struct {
+	sync.Mutex
+	keys map[string][]byte
+}{keys: make(map[string][]byte)}
+
+// generatedKey returns the persistence key generated for the load balancer of a service, generating it if needed.
+func generatedKey(name string) ([]byte, error) {
+	generatedKeys.Lock()
+	defer generatedKeys.Unlock()
+	if key, ok := generatedKeys.keys[name]; ok {
+		return key, nil
+	}
+	slog.Warn("No cookie secret given for persistent load balancer, sessions will not survive a restart",
+		slog.String("service", name))
+	key := make([]byte, persistenceKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	generatedKeys.keys[name] = key
+	return key, nil
+}
+
+func createPersistence(name string, info *cookieInfo) (*services.Persistence, error) {
+	if info == nil {
+		info = &cookieInfo{}
+	}
+	sameSite, err := sameSiteFromString(info.SameSite)
+	if err != nil {
+		return nil, err
+	}
+	// Browsers reject cookies with SameSite=None that are not secure.
+	if sameSite == http.SameSiteNoneMode && !info.Secure {
+		return nil, errSameSiteNoneSecure
+	}
+
+	key := []byte(info.Secret)
+	if len(key) == 0 {
+		if key, err = generatedKey(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return &services.Persistence{
+		CookieName: info.Name,
+		Key:        key,
+		Path:       info.Path,
+		Domain:     info.Domain,
+		Secure:     info.Secure,
+		SameSite:   sameSite,
+		MaxAge:     info.MaxAge,
+	}, nil
+}
+
+func createRetryPolicy(info *retryInfo) (*services.RetryPolicy, error) {
+	policy := &services.RetryPolicy{
+		Attempts:    info.Attempts,
+		StatusCodes: info.StatusCodes,
+		Methods:     info.Methods,
+		Backoff:     info.Backoff,
+		Timeout:     info.Timeout,
+	}
+	on := info.On
+	if on == nil {
+		on = []string{retryOnDial, retryOnTimeout}
+	}
+	for _, condition := range on {
+		switch condition {
+		case retryOnDial:
+			policy.DialErrors = true
+		case retryOnTimeout:
+			policy.Timeouts = true
+		default:
+			return nil, fmt.Errorf("%w: got %s", errInvalidRetryCondition, condition)
+		}
+	}
+	return policy, nil
+}
+
+func createLoadBalancerOptions(name string, info *loadBalancerInfo) (services.LoadBalancerOptions, error) {
+	options := services.LoadBalancerOptions{SlowStart: info.SlowStart}
+	var err error
+	if info.Persistent {
+		options.Persistence, err = createPersistence(name, info.Cookie)
+		if err != nil {
+			return options, err
+		}
+	}
+	if info.Retry != nil {
+		options.Retry, err = createRetryPolicy(info.Retry)
+		if err != nil {
+			return options, err
+		}
+	}
+	if info.Queue != nil {
+		options.Queue = &services.Queue{
+			Size:    info.Queue.Size,
+			Timeout: info.Queue.Timeout,
+		}
+	}
+	if info.OutlierDetection != nil {
+		options.OutlierDetection = &services.OutlierDetection{
+			ConsecutiveFailures: info.OutlierDetection.ConsecutiveFailures,
+			BaseEjectionTime:    info.OutlierDetection.BaseEjectionTime,
+			MaxEjectionTime:     info.OutlierDetection.MaxEjectionTime,
+		}
+	}
+	if info.Hedging != nil {
+		options.Hedging = &services.Hedging{
+			Delay:   info.Hedging.Delay,
+			Budget:  info.Hedging.Budget,
+			Methods: info.Hedging.Methods,
+		}
+	}
+	if info.LoadFeedback != nil {
+		options.LoadFeedback = &services.LoadFeedback{
+			Header:  info.LoadFeedback.Header,
+			Damping: info.LoadFeedback.Damping,
+		}
+	}
+	return options, nil
+}
+
+func createCanary(info *canaryInfo, lbServices []*services.Service) (*services.Canary, error) {
+	if !slices.ContainsFunc(lbServices, func(s *services.Service) bool { return s.Name == info.Service }) {
+		return nil, fmt.Errorf("%w: %s", errCanaryNotInPool, info.Service)
+	}
+	for i, step := range info.Steps {
+		if step <= 0 || step > 1 || (i > 0 && step <= info.Steps[i-1]) {
+			return nil, fmt.Errorf("%w: got %v", errInvalidCanarySteps, info.Steps)
+		}
+	}
+	return &services.Canary{
+		Service:         info.Service,
+		Steps:           info.Steps,
+		Interval:        info.Interval,
+		MaxErrorRate:    info.MaxErrorRate,
+		MaxLatencyRatio: info.MaxLatencyRatio,
+		MinRequests:     info.MinRequests,
+	}, nil
+}
+
+func createConnectionLimit(maxConnections int) *services.ConnectionLimit {
+	if maxConnections <= 0 {
+		return nil
+	}
+	return services.NewConnectionLimit(maxConnections)
 }
 
 // Services parses the config and returns a mapping from hosts to services.
@@ -61,10 +233,17 @@ func (c *Config) Services(docker dockerapi.Docker) (map[string]*services.Service
 			router = services.NewRedirect(*remote)
 		}
 
+		checker, err := createHealthChecker(service.Health)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", errInvalidConfig, name, err)
+		}
+
 		nameService[name] = &services.Service{
+			Name:        name,
 			TLS:         service.TLS,
 			Middlewares: service.Middlewares.List(),
-			Health:      createHealthChecker(service.Health),
+			Health:      checker,
+			Limit:       createConnectionLimit(service.MaxConnections),
 			Router:      router,
 		}
 	}
@@ -73,13 +252,90 @@ func (c *Config) Services(docker dockerapi.Docker) (map[string]*services.Service
 		return nil, fmt.Errorf("%w: %w", errInvalidConfig, err)
 	}
 
+	// Services without a host are only reachable as members of load balancers, whose health checks
+	// are launched along with those of the load balancers.
 	m := make(map[string]*services.Service)
 	for name, service := range c.ServiceConfig {
-		m[service.Host] = nameService[name]
+		if service.Host != "" {
+			m[service.Host] = nameService[name]
+		}
 	}
 	return m, nil
 }
 
+func lookupServices(names []string, nameService map[string]*services.Service) ([]*services.Service, error) {
+	var found []*services.Service
+	for _, serviceName := range names {
+		s, ok := nameService[serviceName]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errNoServiceWithName, serviceName)
+		}
+		found = append(found, s)
+	}
+	return found, nil
+}
+
+// createLoadBalancerStrategy returns the strategy of a load balancer along with its services.
+// The services of tiers are flattened in order of priority.
+func createLoadBalancerStrategy(
+	info *loadBalancerInfo,
+	nameService map[string]*services.Service,
+) (services.Strategy, []*services.Service, error) {
+	if info.Tiers == nil {
+		strategy, err := services.NewStrategy(info.Strategy)
+		if err != nil {
+			return nil, nil, err
+		}
+		lbServices, err := lookupServices(info.ServiceNames, nameService)
+		return strategy, lbServices, err
+	}
+	if info.ServiceNames != nil {
+		return nil, nil, errTiersWithServiceNames
+	}
+
+	var lbServices []*services.Service
+	tiers := make([]services.Tier, 0, len(info.Tiers))
+	for _, tier := range info.Tiers {
+		// Tiers without a strategy of their own use the load balancer's strategy.
+		name := tier.Strategy
+		if name == "" {
+			name = info.Strategy
+		}
+		strategy, err := services.NewStrategy(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		tierServices, err := lookupServices(tier.ServiceNames, nameService)
+		if err != nil {
+			return nil, nil, err
+		}
+		lbServices = append(lbServices, tierServices...)
+		tiers = append(tiers, services.Tier{
+			Size:         len(tierServices),
+			Strategy:     strategy,
+			MinAvailable: tier.MinHealthy,
+		})
+	}
+	return services.NewTiered(tiers), lbServices, nil
+}
+
+// maxHealthyPercent is the percentage of a load balancer's services that are healthy when all of them are.
+const maxHealthyPercent = 100
+
+// createHealthPolicy returns the policy deciding whether a load balancer with the given number of services is up.
+// Without a policy, a load balancer is up if any of its services is up.
+func createHealthPolicy(info *healthPolicyInfo, services int) (health.Policy, error) {
+	if info == nil {
+		return health.Policy{}, nil
+	}
+	if info.MinHealthy < 0 || info.MinHealthy > services ||
+		info.MinHealthyPercent < 0 || info.MinHealthyPercent > maxHealthyPercent {
+		return health.Policy{}, fmt.Errorf("%w: got minHealthy %d and minHealthyPercent %v with %d services",
+			errInvalidHealthPolicy, info.MinHealthy, info.MinHealthyPercent, services)
+	}
+	return health.Policy{MinUp: info.MinHealthy, MinUpPercent: info.MinHealthyPercent}, nil
+}
+
 func parseLoadBalancers(conf serviceConfig, nameService map[string]*services.Service) error {
 	tempNameService := make(map[string]*services.Service)
 	for name, service := range conf {
@@ -87,31 +343,44 @@ func parseLoadBalancers(conf serviceConfig, nameService map[string]*services.Ser
 			continue
 		}
 
-		strategy, err := services.NewStrategy(service.LoadBalancer.Strategy)
+		strategy, lbServices, err := createLoadBalancerStrategy(service.LoadBalancer, nameService)
 		if err != nil {
-			return err
+			return fmt.Errorf("%s: %w", name, err)
 		}
 
-		var lbServices []*services.Service
-		for _, serviceName := range conf[name].LoadBalancer.ServiceNames {
-			if s, ok := nameService[serviceName]; ok {
-				lbServices = append(lbServices, s)
-			} else {
-				return fmt.Errorf("%w: %s", errNoServiceWithName, serviceName)
+		options, err := createLoadBalancerOptions(name, service.LoadBalancer)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if service.LoadBalancer.Canary != nil {
+			options.Canary, err = createCanary(service.LoadBalancer.Canary, lbServices)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
 			}
 		}
 
 		lb := services.NewLoadBalancer(
 			service.Host,
 			strategy,
-			service.LoadBalancer.Persistent,
 			lbServices,
+			options,
 		)
 
+		// The health of a load balancer is computed from its members.
+		var info health.Info
+		if service.Health != nil {
+			info = *service.Health
+		}
+		policy, err := createHealthPolicy(service.LoadBalancer.HealthPolicy, len(lbServices))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
 		tempNameService[name] = &services.Service{
+			Name:        name,
 			TLS:         service.TLS,
 			Middlewares: service.Middlewares.List(),
-			Health:      createHealthChecker(service.Health),
+			Health:      health.NewGroup(info, policy, lb.Members()),
 			Router:      lb,
 		}
 	}
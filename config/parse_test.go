@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 )
@@ -105,6 +106,136 @@ func TestConfigServicesError(t *testing.T) {
 			},
 			err: errNoServiceWithName,
 		},
+		"load balancer with invalid cookie sameSite": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							Persistent: true,
+							Cookie:     &cookieInfo{SameSite: "invalid"},
+						},
+					},
+				},
+			},
+			err: errInvalidSameSite,
+		},
+		"load balancer with insecure cookie sameSite none": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							Persistent: true,
+							Cookie:     &cookieInfo{SameSite: "none"},
+						},
+					},
+				},
+			},
+			err: errSameSiteNoneSecure,
+		},
+		"load balancer with invalid retry condition": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							Retry: &retryInfo{On: []string{"invalid"}},
+						},
+					},
+				},
+			},
+			err: errInvalidRetryCondition,
+		},
+		"load balancer with tiers and service names": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{Redirect: "http://example.com"},
+				},
+				"bar": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							ServiceNames: []string{"foo"},
+							Tiers:        []tierInfo{{ServiceNames: []string{"foo"}}},
+						},
+					},
+				},
+			},
+			err: errTiersWithServiceNames,
+		},
+		"load balancer tier with unknown service": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							Tiers: []tierInfo{{ServiceNames: []string{"invalid"}}},
+						},
+					},
+				},
+			},
+			err: errNoServiceWithName,
+		},
+		"load balancer with canary outside of the pool": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{Redirect: "http://example.com"},
+				},
+				"bar": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							ServiceNames: []string{"foo"},
+							Canary:       &canaryInfo{Service: "baz"},
+						},
+					},
+				},
+			},
+			err: errCanaryNotInPool,
+		},
+		"load balancer with decreasing canary steps": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{Redirect: "http://example.com"},
+				},
+				"bar": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							ServiceNames: []string{"foo"},
+							Canary:       &canaryInfo{Service: "foo", Steps: []float64{0.5, 0.1}},
+						},
+					},
+				},
+			},
+			err: errInvalidCanarySteps,
+		},
+		"load balancer requiring more healthy services than it has": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{Redirect: "http://example.com"},
+				},
+				"bar": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							ServiceNames: []string{"foo"},
+							HealthPolicy: &healthPolicyInfo{MinHealthy: 2},
+						},
+					},
+				},
+			},
+			err: errInvalidHealthPolicy,
+		},
+		"load balancer requiring more than all services to be healthy": {
+			services: serviceConfig{
+				"foo": {
+					routers: routers{Redirect: "http://example.com"},
+				},
+				"bar": {
+					routers: routers{
+						LoadBalancer: &loadBalancerInfo{
+							ServiceNames: []string{"foo"},
+							HealthPolicy: &healthPolicyInfo{MinHealthyPercent: 150},
+						},
+					},
+				},
+			},
+			err: errInvalidHealthPolicy,
+		},
 		"load balancer tries to load balance itself": {
 			services: serviceConfig{
 				"foo": {
@@ -150,3 +281,25 @@ func TestConfigServicesError(t *testing.T) {
 		})
 	}
 }
+
+func TestCreatePersistenceGeneratedKey(t *testing.T) {
+	first, err := createPersistence("generated-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reloading the configuration must not invalidate the cookies signed with the generated key.
+	second, err := createPersistence("generated-key", &cookieInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Key, second.Key) {
+		t.Errorf("expected key %x, got %x", first.Key, second.Key)
+	}
+	other, err := createPersistence("other-generated-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first.Key, other.Key) {
+		t.Errorf("expected different keys for different services, got %x", other.Key)
+	}
+}
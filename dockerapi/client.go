@@ -3,11 +3,29 @@ package dockerapi
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+
+	"github.com/plamorg/voltproxy/metrics"
+)
+
+var (
+	requestDuration = metrics.Default.NewHistogram("voltproxy_docker_request_duration_seconds",
+		"Time taken by the Docker API to respond by operation.", metrics.DefaultBuckets, "operation")
+	requestErrors = metrics.Default.NewCounter("voltproxy_docker_request_errors_total",
+		"Number of failed Docker API requests by operation.", "operation")
 )
 
+// observe records the latency and the error, if any, of a Docker API request.
+func observe(operation string, start time.Time, err error) {
+	requestDuration.Observe(time.Since(start).Seconds(), operation)
+	if err != nil {
+		requestErrors.Inc(operation)
+	}
+}
+
 // Client is a wrapper around the Docker client.
 type Client struct {
 	client *client.Client
@@ -33,7 +51,9 @@ func (c Client) LogValue() slog.Value {
 
 // ContainerList returns the list of containers from the Docker client.
 func (c *Client) ContainerList() ([]Container, error) {
+	start := time.Now()
 	clientContainers, err := c.client.ContainerList(context.Background(), types.ContainerListOptions{})
+	observe("containerList", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -4,8 +4,11 @@ import (
 	"os"
 	"testing"
 
+	"github.com/plamorg/voltproxy/admin"
 	"github.com/plamorg/voltproxy/config"
 	"github.com/plamorg/voltproxy/dockerapi"
+	"github.com/plamorg/voltproxy/services"
+	"github.com/plamorg/voltproxy/tracing"
 )
 
 func TestExamples(t *testing.T) {
@@ -14,10 +17,12 @@ func TestExamples(t *testing.T) {
 		"./middlewares/ip-allow.yml",
 		"./middlewares/x-forward.yml",
 		"./additional-configuration.yml",
+		"./admin.yml",
 		"./basic.yml",
 		"./health-check.yml",
 		"./load-balancer.yml",
 		"./multiple-middlewares.yml",
+		"./tracing.yml",
 	}
 
 	for _, example := range examples {
@@ -37,6 +42,24 @@ func TestExamples(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+
+			if _, err = conf.Notifier(); err != nil {
+				t.Fatal(err)
+			}
+
+			if conf.Tracing != nil {
+				tracer, err := tracing.NewTracer(*conf.Tracing)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tracer.Stop()
+			}
+
+			if conf.Admin != nil {
+				if _, err = admin.New(*conf.Admin, services.NewRegistry(nil), nil, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
 		})
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/plamorg/voltproxy/config"
 	"github.com/plamorg/voltproxy/dockerapi"
@@ -71,7 +72,12 @@ func NewInstance(t *testing.T, confData []byte, containers ...[]dockerapi.Contai
 		t.Fatal(err)
 	}
 
-	services.LaunchHealthChecks(serviceMap)
+	notifier, err := conf.Notifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services.LaunchHealthChecks(serviceMap, notifier)
 
 	server := httptest.NewServer(services.Handler(serviceMap))
 	tlsServer := httptest.NewServer(services.TLSHandler(serviceMap))
@@ -110,6 +116,28 @@ func (i *Instance) RequestHost(host string) *http.Response {
 	return i.Request(req)
 }
 
+// availableTimeout is how long RequestHostAvailable waits for a service to become available.
+const availableTimeout = 5 * time.Second
+
+// RequestHostAvailable sends requests to the reverse proxy with the given host until the
+// response is not 503 Service Unavailable, for example because a health check has not passed yet.
+// Will call t.Fatal if the service does not become available in time.
+func (i *Instance) RequestHostAvailable(host string) *http.Response {
+	i.t.Helper()
+	deadline := time.Now().Add(availableTimeout)
+	for {
+		res := i.RequestHost(host)
+		if res.StatusCode != http.StatusServiceUnavailable {
+			return res
+		}
+		res.Body.Close()
+		if time.Now().After(deadline) {
+			i.t.Fatalf("service with host %s did not become available", host)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 // RequestHostTLS sends a request to the reverse proxy with the given host, using TLS.
 func (i *Instance) RequestHostTLS(host string) *http.Response {
 	i.t.Helper()
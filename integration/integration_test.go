@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"slices"
 	"testing"
+	"time"
 
 	"github.com/plamorg/voltproxy/dockerapi"
 )
@@ -353,6 +354,7 @@ services:
     health:
       path: "/health"
       interval: 0.5ms
+      gracePeriod: -1s
   up:
     redirect: "%s"`, unhealthy.URL(), up.URL())
 
@@ -366,6 +368,42 @@ services:
 	}
 }
 
+func TestLoadBalancerHealthDoesNotRoute(t *testing.T) {
+	serverName := "Server-Name"
+	foo := NewMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(serverName, "foo")
+	})
+	bar := NewMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(serverName, "bar")
+	})
+
+	// The load balancer's health is computed from its members, so checking it does not advance the cursor.
+	conf := fmt.Sprintf(`
+services:
+  lb:
+    host: lb.example.com
+    loadBalancer:
+      strategy: roundRobin
+      serviceNames: ["foo", "bar"]
+    health:
+      interval: 0.5ms
+  foo:
+    redirect: "%s"
+  bar:
+    redirect: "%s"`, foo.URL(), bar.URL())
+	i := NewInstance(t, []byte(conf), nil)
+
+	for _, expectedServer := range []string{"foo", "bar", "foo", "bar"} {
+		time.Sleep(5 * time.Millisecond)
+		res := i.RequestHost("lb.example.com")
+		defer res.Body.Close()
+
+		if res.Header.Get(serverName) != expectedServer {
+			t.Fatalf("expected header %s to be %s, got %s", serverName, expectedServer, res.Header.Get(serverName))
+		}
+	}
+}
+
 func TestLoadBalancerHealthUp(t *testing.T) {
 	// Although the server normally returns StatusForbidden, it returns a healthy status.
 	// Thus, the health check should pass fine.
@@ -391,12 +429,49 @@ services:
       path: "/what_is_my_health"`, up.URL())
 	i := NewInstance(t, []byte(conf), nil)
 
+	// The only service is unavailable until its first health check passes.
+	res := i.RequestHostAvailable("lb.example.com")
+	defer res.Body.Close()
+
+	if res.StatusCode != expectedCode {
+		t.Fatalf("expected status code %d, got %d", expectedCode, res.StatusCode)
+	}
+}
+
+func TestLoadBalancerRetry(t *testing.T) {
+	down := NewMockServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	downURL := down.URL()
+	down.server.Close()
+
+	expectedCode := http.StatusTeapot
+	up := NewMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(expectedCode)
+	})
+
+	conf := fmt.Sprintf(`
+services:
+  lb:
+    host: lb.example.com
+    loadBalancer:
+      strategy: failover
+      serviceNames: ["down", "up"]
+      retry:
+        attempts: 2
+  down:
+    redirect: "%s"
+  up:
+    redirect: "%s"`, downURL, up.URL())
+	i := NewInstance(t, []byte(conf), nil)
+
 	res := i.RequestHost("lb.example.com")
 	defer res.Body.Close()
 
 	if res.StatusCode != expectedCode {
 		t.Fatalf("expected status code %d, got %d", expectedCode, res.StatusCode)
 	}
+	if attempts := res.Header.Get("X-Voltproxy-Attempts"); attempts != "2" {
+		t.Fatalf("expected 2 attempts, got %s", attempts)
+	}
 }
 
 func TestFetchRemoteDynamically(t *testing.T) {
@@ -0,0 +1,256 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Access log formats.
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+	FormatTemplate = "template"
+)
+
+var (
+	errInvalidAccessFormat = fmt.Errorf("invalid access log format, must be one of: common, combined, json, template")
+	errMissingTemplate     = fmt.Errorf("access log template format requires a template")
+	errInvalidTemplate     = fmt.Errorf("invalid access log template")
+)
+
+// clfTimeFormat is the time format of the Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// megabyte is the unit of the maximum size of an access log file.
+const megabyte = 1 << 20
+
+// AccessConfig defines the configuration for the access log.
+type AccessConfig struct {
+	// Format is common, combined, json or template. Defaults to common.
+	Format string `yaml:"format"`
+	// Template is the text/template of each line if the format is template, e.g.
+	// "{{.ClientIP}} {{.Service}} {{.Status}} {{.Duration}}". The fields are those of AccessEntry.
+	Template string `yaml:"template"`
+	// Path is the file the access log is written to. Defaults to stdout.
+	Path string `yaml:"path"`
+	// UserHeader is the request header with the authenticated user, e.g. one set by an authForward middleware.
+	UserHeader string `yaml:"userHeader"`
+	// MaxSize is the size in megabytes after which the file is rotated. The file is not rotated by size if 0.
+	MaxSize int `yaml:"maxSize"`
+	// RotateInterval is how often the file is rotated. The file is not rotated by time if 0.
+	RotateInterval time.Duration `yaml:"rotateInterval"`
+	// MaxBackups is the number of rotated files that are kept. All of them are kept if 0.
+	MaxBackups int `yaml:"maxBackups"`
+}
+
+// AccessEntry describes a request that was handled.
+type AccessEntry struct {
+	Time      time.Time
+	ClientIP  string
+	User      string
+	Method    string
+	URI       string
+	Proto     string
+	Host      string
+	Referer   string
+	UserAgent string
+	// Service is the name of the service that handled the request, and Backend is the URL it was routed to.
+	Service  string
+	Backend  string
+	Status   int
+	Bytes    int64
+	Duration time.Duration
+	// RequestID is the ID of the request, which is also attached to the records logged while handling it.
+	RequestID string
+}
+
+// accessJSON is the JSON representation of an AccessEntry.
+type accessJSON struct {
+	Time            time.Time `json:"time"`
+	ClientIP        string    `json:"clientIP"`
+	User            string    `json:"user,omitempty"`
+	Method          string    `json:"method"`
+	URI             string    `json:"uri"`
+	Proto           string    `json:"proto"`
+	Host            string    `json:"host"`
+	Referer         string    `json:"referer,omitempty"`
+	UserAgent       string    `json:"userAgent,omitempty"`
+	Service         string    `json:"service"`
+	Backend         string    `json:"backend,omitempty"`
+	Status          int       `json:"status"`
+	Bytes           int64     `json:"bytes"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	RequestID       string    `json:"requestID,omitempty"`
+}
+
+// orDash returns the value, or a dash if it is empty, as in the Common Log Format.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// quote quotes a value of the Common Log Format, escaping quotes, backslashes and control characters.
+func quote(value string) string {
+	return strconv.Quote(orDash(value))
+}
+
+func writeCommon(b *bytes.Buffer, entry AccessEntry) {
+	size := "-"
+	if entry.Bytes > 0 {
+		size = strconv.FormatInt(entry.Bytes, 10)
+	}
+	fmt.Fprintf(b, "%s - %s [%s] %s %d %s",
+		orDash(entry.ClientIP),
+		orDash(entry.User),
+		entry.Time.Format(clfTimeFormat),
+		strconv.Quote(entry.Method+" "+entry.URI+" "+entry.Proto),
+		entry.Status,
+		size)
+}
+
+func writeCombined(b *bytes.Buffer, entry AccessEntry) {
+	writeCommon(b, entry)
+	fmt.Fprintf(b, " %s %s", quote(entry.Referer), quote(entry.UserAgent))
+}
+
+func writeJSON(b *bytes.Buffer, entry AccessEntry) error {
+	return json.NewEncoder(b).Encode(accessJSON{
+		Time:            entry.Time,
+		ClientIP:        entry.ClientIP,
+		User:            entry.User,
+		Method:          entry.Method,
+		URI:             entry.URI,
+		Proto:           entry.Proto,
+		Host:            entry.Host,
+		Referer:         entry.Referer,
+		UserAgent:       entry.UserAgent,
+		Service:         entry.Service,
+		Backend:         entry.Backend,
+		Status:          entry.Status,
+		Bytes:           entry.Bytes,
+		DurationSeconds: entry.Duration.Seconds(),
+		RequestID:       entry.RequestID,
+	})
+}
+
+// formatterFromConfig returns the function that formats the entries of the access log.
+func formatterFromConfig(c AccessConfig) (func(*bytes.Buffer, AccessEntry) error, error) {
+	switch c.Format {
+	case FormatCommon, "":
+		return func(b *bytes.Buffer, entry AccessEntry) error {
+			writeCommon(b, entry)
+			return nil
+		}, nil
+	case FormatCombined:
+		return func(b *bytes.Buffer, entry AccessEntry) error {
+			writeCombined(b, entry)
+			return nil
+		}, nil
+	case FormatJSON:
+		return writeJSON, nil
+	case FormatTemplate:
+		if c.Template == "" {
+			return nil, errMissingTemplate
+		}
+		tmpl, err := template.New("access").Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidTemplate, err)
+		}
+		return func(b *bytes.Buffer, entry AccessEntry) error {
+			return tmpl.Execute(b, entry)
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: got %s", errInvalidAccessFormat, c.Format)
+	}
+}
+
+// AccessLogger writes an access log.
+type AccessLogger struct {
+	AccessConfig
+
+	format func(*bytes.Buffer, AccessEntry) error
+	mu     sync.Mutex
+	out    io.Writer
+	// file is the file being written to, if any.
+	file *rotatingFile
+}
+
+// NewAccessLogger creates an access logger with the given configuration, opening its file if it has one.
+func NewAccessLogger(c AccessConfig) (*AccessLogger, error) {
+	format, err := formatterFromConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	l := &AccessLogger{AccessConfig: c, format: format, out: os.Stdout}
+	if c.Path != "" {
+		l.file, err = openRotatingFile(c.Path, int64(c.MaxSize)*megabyte, c.RotateInterval, c.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		l.out = l.file
+	}
+	return l, nil
+}
+
+// Log writes an entry to the access log.
+func (l *AccessLogger) Log(entry AccessEntry) {
+	var b bytes.Buffer
+	if err := l.format(&b, entry); err != nil {
+		slog.Warn("Error while formatting access log entry", slog.Any("error", err))
+		return
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteByte('\n')
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := b.WriteTo(l.out); err != nil {
+		slog.Warn("Error while writing access log", slog.Any("error", err))
+	}
+}
+
+// Reopen reopens the file of the access log, e.g. after it has been moved by an external tool.
+func (l *AccessLogger) Reopen() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.reopen()
+}
+
+// Close closes the file of the access log, if any.
+func (l *AccessLogger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// accessLogger is the access logger set up by Initialize, if any.
+var accessLogger atomic.Pointer[AccessLogger]
+
+// Access returns the access logger, or nil if the access log is disabled.
+func Access() *AccessLogger {
+	return accessLogger.Load()
+}
+
+// setAccess replaces the access logger, closing the previous one.
+func setAccess(l *AccessLogger) {
+	if previous := accessLogger.Swap(l); previous != nil {
+		if err := previous.Close(); err != nil {
+			slog.Warn("Error while closing access log", slog.Any("error", err))
+		}
+	}
+}
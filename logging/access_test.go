@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEntry = AccessEntry{
+	Time:      time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC),
+	ClientIP:  "192.0.2.1",
+	User:      "alice",
+	Method:    "GET",
+	URI:       "/foo?bar=1",
+	Proto:     "HTTP/1.1",
+	Host:      "example.com",
+	Referer:   "https://example.com/",
+	UserAgent: `curl/8.0 "test"`,
+	Service:   "foo",
+	Backend:   "http://172.20.0.2:8080",
+	Status:    200,
+	Bytes:     1234,
+	Duration:  1500 * time.Millisecond,
+	RequestID: "4b6f4b1e-3c2a-4d8e-9f10-6a7b8c9d0e1f",
+}
+
+func TestAccessFormats(t *testing.T) {
+	tests := map[string]struct {
+		config   AccessConfig
+		entry    AccessEntry
+		expected string
+	}{
+		"common": {
+			config:   AccessConfig{},
+			entry:    testEntry,
+			expected: `192.0.2.1 - alice [05/Mar/2024:14:30:00 +0000] "GET /foo?bar=1 HTTP/1.1" 200 1234` + "\n",
+		},
+		"common without user or body": {
+			config: AccessConfig{Format: FormatCommon},
+			entry: AccessEntry{
+				Time:     testEntry.Time,
+				ClientIP: "::1",
+				Method:   "HEAD",
+				URI:      "/",
+				Proto:    "HTTP/2.0",
+				Status:   204,
+			},
+			expected: `::1 - - [05/Mar/2024:14:30:00 +0000] "HEAD / HTTP/2.0" 204 -` + "\n",
+		},
+		"combined": {
+			config: AccessConfig{Format: FormatCombined},
+			entry:  testEntry,
+			expected: `192.0.2.1 - alice [05/Mar/2024:14:30:00 +0000] "GET /foo?bar=1 HTTP/1.1" 200 1234 ` +
+				`"https://example.com/" "curl/8.0 \"test\""` + "\n",
+		},
+		"template": {
+			config:   AccessConfig{Format: FormatTemplate, Template: "{{.ClientIP}} {{.Service}} {{.Backend}} {{.Duration}}"},
+			entry:    testEntry,
+			expected: "192.0.2.1 foo http://172.20.0.2:8080 1.5s\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			logger, err := NewAccessLogger(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger.out = &b
+			logger.Log(test.entry)
+			if b.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, b.String())
+			}
+		})
+	}
+}
+
+func TestAccessFormatJSON(t *testing.T) {
+	var b bytes.Buffer
+	logger, err := NewAccessLogger(AccessConfig{Format: FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.out = &b
+	logger.Log(testEntry)
+
+	var got map[string]any
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"clientIP":        "192.0.2.1",
+		"user":            "alice",
+		"service":         "foo",
+		"backend":         "http://172.20.0.2:8080",
+		"status":          float64(200),
+		"bytes":           float64(1234),
+		"durationSeconds": 1.5,
+		"requestID":       "4b6f4b1e-3c2a-4d8e-9f10-6a7b8c9d0e1f",
+	}
+	for key, value := range expected {
+		if got[key] != value {
+			t.Errorf("expected %s %v, got %v", key, value, got[key])
+		}
+	}
+}
+
+func TestNewAccessLoggerErrors(t *testing.T) {
+	tests := map[string]struct {
+		config   AccessConfig
+		expected error
+	}{
+		"invalid format":   {config: AccessConfig{Format: "invalid"}, expected: errInvalidAccessFormat},
+		"missing template": {config: AccessConfig{Format: FormatTemplate}, expected: errMissingTemplate},
+		"invalid template": {config: AccessConfig{Format: FormatTemplate, Template: "{{.Foo"}, expected: errInvalidTemplate},
+		"invalid path": {
+			config:   AccessConfig{Path: filepath.Join(t.TempDir(), "missing", "access.log")},
+			expected: os.ErrNotExist,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewAccessLogger(test.config); !errors.Is(err, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestAccessLoggerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	logger, err := NewAccessLogger(AccessConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Log(testEntry)
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Log(testEntry)
+
+	for _, name := range []string{path, path + ".moved"} {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(content), "\n"); lines != 1 {
+			t.Errorf("%s: expected %d line, got %d", name, 1, lines)
+		}
+	}
+}
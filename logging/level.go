@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+)
+
+// Keys of the attributes that select the level override of a logger.
+const (
+	hostKey      = "host"
+	requestIDKey = "requestID"
+)
+
+var errInvalidSampleRate = fmt.Errorf("sample rate must be between 0 and 1")
+
+// globalLevel is the level of the records that are logged, which can be changed at runtime.
+var globalLevel slog.LevelVar
+
+// configuredLevel is the level set up by Initialize, which ToggleDebug restores.
+var configuredLevel atomic.Int64
+
+// Level returns the current log level.
+func Level() slog.Level {
+	return globalLevel.Level()
+}
+
+// SetLevel changes the log level at runtime to debug, info, warn or error.
+func SetLevel(level string) error {
+	l, err := levelFromString(level)
+	if err != nil {
+		return err
+	}
+	globalLevel.Set(l)
+	return nil
+}
+
+// ToggleDebug changes the log level to debug, or back to the configured level if it already is debug,
+// and returns the new level.
+func ToggleDebug() slog.Level {
+	level := slog.LevelDebug
+	if Level() == slog.LevelDebug {
+		level = slog.Level(configuredLevel.Load())
+	}
+	globalLevel.Set(level)
+	return level
+}
+
+// LevelName returns the name of a level as accepted by SetLevel, e.g. info.
+func LevelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// ServiceConfig overrides the log level of the records of a service.
+type ServiceConfig struct {
+	// Level is the level of the records of the service, which may be lower or higher than the global level.
+	Level string `yaml:"level"`
+	// SampleRate is the fraction of requests whose records below the global level are logged. Defaults to 1.
+	// Either all or none of the records of a request are logged. Records outside of requests are sampled one by one.
+	SampleRate *float64 `yaml:"sampleRate"`
+}
+
+// override is a parsed ServiceConfig.
+type override struct {
+	level      slog.Level
+	sampleRate float64
+}
+
+// parseOverrides parses the level overrides of services, keyed by host.
+func parseOverrides(services map[string]ServiceConfig) (map[string]override, error) {
+	overrides := make(map[string]override, len(services))
+	for host, c := range services {
+		level, err := levelFromString(c.Level)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+		sampleRate := 1.0
+		if c.SampleRate != nil {
+			sampleRate = *c.SampleRate
+		}
+		if sampleRate < 0 || sampleRate > 1 {
+			return nil, fmt.Errorf("%s: %w: got %v", host, errInvalidSampleRate, sampleRate)
+		}
+		overrides[host] = override{level: level, sampleRate: sampleRate}
+	}
+	return overrides, nil
+}
+
+// sampled returns whether the records of a request are logged. The decision depends only on the request ID,
+// so that it is the same for every record of the request.
+func (o override) sampled(requestID string) bool {
+	if o.sampleRate >= 1 {
+		return true
+	}
+	if requestID == "" {
+		return rand.Float64() < o.sampleRate
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(requestID))
+	return float64(h.Sum32()) < o.sampleRate*math.MaxUint32
+}
+
+// levelHandler only passes on the records of the global level, or of the level override of their host.
+// The host of a record is that of the logger it was logged with, or that of its attributes.
+type levelHandler struct {
+	next      slog.Handler
+	overrides map[string]override
+	// minOverride is the lowest level of the overrides.
+	minOverride slog.Level
+
+	// hostKnown is whether the host of the logger is known, in which case override is its override, if any.
+	hostKnown   bool
+	override    override
+	hasOverride bool
+	requestID   string
+	// grouped is whether attributes are added to a group, in which case they are not those of the logger.
+	grouped bool
+}
+
+// newLevelHandler returns a handler that applies the global level and the level overrides before passing
+// records on to the next handler.
+func newLevelHandler(next slog.Handler, overrides map[string]override) *levelHandler {
+	h := &levelHandler{next: next, overrides: overrides, minOverride: math.MaxInt}
+	for _, o := range overrides {
+		h.minOverride = min(h.minOverride, o.level)
+	}
+	return h
+}
+
+// allowed returns whether a record of the level is logged, given the override of its host, if any.
+func allowed(o override, hasOverride bool, level slog.Level, requestID string) bool {
+	global := Level()
+	if !hasOverride {
+		return level >= global
+	}
+	if level < o.level {
+		return false
+	}
+	return level >= global || o.sampled(requestID)
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if h.hostKnown {
+		return allowed(h.override, h.hasOverride, level, h.requestID)
+	}
+	// The host may be one of the attributes of the record, which are only known once it is handled.
+	return level >= Level() || level >= h.minOverride
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.hostKnown && len(h.overrides) > 0 {
+		var o override
+		var hasOverride bool
+		requestID := h.requestID
+		if !h.grouped {
+			r.Attrs(func(a slog.Attr) bool {
+				switch a.Key {
+				case hostKey:
+					o, hasOverride = h.overrides[a.Value.String()]
+				case requestIDKey:
+					requestID = a.Value.String()
+				}
+				return true
+			})
+		}
+		if !allowed(o, hasOverride, r.Level, requestID) {
+			return nil
+		}
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.next = h.next.WithAttrs(attrs)
+	if !h.grouped {
+		for _, a := range attrs {
+			switch a.Key {
+			case hostKey:
+				c.hostKnown = true
+				c.override, c.hasOverride = h.overrides[a.Value.String()]
+			case requestIDKey:
+				c.requestID = a.Value.String()
+			}
+		}
+	}
+	return &c
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.next = h.next.WithGroup(name)
+	c.grouped = true
+	return &c
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+func TestSetLevel(t *testing.T) {
+	defer globalLevel.Set(slog.LevelInfo)
+	configuredLevel.Store(int64(slog.LevelWarn))
+
+	if err := SetLevel("error"); err != nil {
+		t.Fatal(err)
+	}
+	if Level() != slog.LevelError {
+		t.Errorf("expected level %s, got %s", slog.LevelError, Level())
+	}
+	if err := SetLevel("invalid"); !errors.Is(err, errInvalidLevel) {
+		t.Errorf("expected error %s, got %s", errInvalidLevel, err)
+	}
+	if level := ToggleDebug(); level != slog.LevelDebug {
+		t.Errorf("expected level %s, got %s", slog.LevelDebug, level)
+	}
+	if level := ToggleDebug(); level != slog.LevelWarn {
+		t.Errorf("expected configured level %s, got %s", slog.LevelWarn, level)
+	}
+}
+
+func TestParseOverridesErrors(t *testing.T) {
+	invalidRate := 1.5
+	tests := map[string]struct {
+		config   ServiceConfig
+		expected error
+	}{
+		"invalid level":       {config: ServiceConfig{Level: "invalid"}, expected: errInvalidLevel},
+		"invalid sample rate": {config: ServiceConfig{SampleRate: &invalidRate}, expected: errInvalidSampleRate},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseOverrides(map[string]ServiceConfig{"example.com": test.config})
+			if !errors.Is(err, test.expected) {
+				t.Errorf("expected error %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	never := 0.0
+	overrides, err := parseOverrides(map[string]ServiceConfig{
+		"debug.example.com":   {Level: "debug"},
+		"quiet.example.com":   {Level: "warn"},
+		"sampled.example.com": {Level: "debug", SampleRate: &never},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		host string
+		// inRecord is whether the host is an attribute of the record rather than of the logger.
+		inRecord bool
+		level    slog.Level
+		logged   bool
+	}{
+		"below global level":             {host: "other.example.com", level: slog.LevelDebug, logged: false},
+		"global level":                   {host: "other.example.com", level: slog.LevelInfo, logged: true},
+		"lower override":                 {host: "debug.example.com", level: slog.LevelDebug, logged: true},
+		"lower override in record":       {host: "debug.example.com", inRecord: true, level: slog.LevelDebug, logged: true},
+		"higher override":                {host: "quiet.example.com", level: slog.LevelInfo, logged: false},
+		"higher override in record":      {host: "quiet.example.com", inRecord: true, level: slog.LevelInfo, logged: false},
+		"above higher override":          {host: "quiet.example.com", level: slog.LevelError, logged: true},
+		"sampled out below global level": {host: "sampled.example.com", level: slog.LevelDebug, logged: false},
+		"never sampled out global level": {host: "sampled.example.com", level: slog.LevelInfo, logged: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			logger := slog.New(newLevelHandler(slog.NewTextHandler(&b, &slog.HandlerOptions{Level: allLevels}), overrides))
+			if test.inRecord {
+				logger.Log(context.Background(), test.level, "message", slog.String(hostKey, test.host))
+			} else {
+				logger.With(slog.String(hostKey, test.host)).Log(context.Background(), test.level, "message")
+			}
+			if logged := b.Len() > 0; logged != test.logged {
+				t.Errorf("expected logged %v, got %v", test.logged, logged)
+			}
+		})
+	}
+}
+
+func TestOverrideSampled(t *testing.T) {
+	o := override{level: slog.LevelDebug, sampleRate: 0.5}
+	sampled := 0
+	const requests = 1000
+	for i := 0; i < requests; i++ {
+		id := fmt.Sprintf("request-%d", i)
+		if o.sampled(id) != o.sampled(id) {
+			t.Fatalf("expected the same sampling decision for %s", id)
+		}
+		if o.sampled(id) {
+			sampled++
+		}
+	}
+	if sampled < requests*4/10 || sampled > requests*6/10 {
+		t.Errorf("expected about %d sampled requests, got %d", requests/2, sampled)
+	}
+}
@@ -3,8 +3,9 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
+	"math"
 )
 
 var (
@@ -13,10 +14,47 @@ var (
 	errInvalidSettings = fmt.Errorf("invalid logging settings")
 )
 
+// allLevels lets the handlers of the outputs accept records of every level, as levels are applied before them.
+const allLevels = slog.Level(math.MinInt)
+
 // Config defines the configuration for the logger.
 type Config struct {
 	Level   string `yaml:"level"`
 	Handler string `yaml:"handler"`
+	// Outputs are the destinations of the logs. Defaults to stdout.
+	Outputs []OutputConfig `yaml:"outputs"`
+	// Services override the level of the records of services, keyed by host.
+	Services map[string]ServiceConfig `yaml:"services"`
+	// Access is the configuration of the access log, which is disabled if nil.
+	Access *AccessConfig `yaml:"access"`
+	// RequestID is the configuration of the request IDs attached to every record logged while handling a request.
+	RequestID RequestIDConfig `yaml:"requestID"`
+}
+
+// LogValue logs the logging configuration, including its outputs and level overrides,
+// and the format and path of the access log if it is enabled.
+func (c Config) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("level", c.Level), slog.String("handler", c.Handler)}
+	if len(c.Outputs) > 0 {
+		types := make([]string, 0, len(c.Outputs))
+		for _, output := range c.Outputs {
+			types = append(types, output.Type)
+		}
+		attrs = append(attrs, slog.Any("outputs", types))
+	}
+	if len(c.Services) > 0 {
+		services := make([]any, 0, len(c.Services))
+		for host, service := range c.Services {
+			services = append(services, slog.String(host, service.Level))
+		}
+		attrs = append(attrs, slog.Group("services", services...))
+	}
+	if c.Access != nil {
+		attrs = append(attrs, slog.Group("access",
+			slog.String("format", c.Access.Format),
+			slog.String("path", c.Access.Path)))
+	}
+	return slog.GroupValue(attrs...)
 }
 
 func levelFromString(level string) (slog.Level, error) {
@@ -34,31 +72,95 @@ func levelFromString(level string) (slog.Level, error) {
 	}
 }
 
-func handlerFromString(handler string) (func(*slog.HandlerOptions) slog.Handler, error) {
+func handlerFromString(handler string) (func(io.Writer, *slog.HandlerOptions) slog.Handler, error) {
 	switch handler {
 	case "text", "":
-		return func(opts *slog.HandlerOptions) slog.Handler { return slog.NewTextHandler(os.Stdout, opts) }, nil
+		return func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewTextHandler(w, opts) }, nil
 	case "json":
-		return func(opts *slog.HandlerOptions) slog.Handler { return slog.NewJSONHandler(os.Stdout, opts) }, nil
+		return func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewJSONHandler(w, opts) }, nil
 	default:
 		return nil, fmt.Errorf("%w: %s", errInvalidHandler, handler)
 	}
 }
 
-// Initialize initializes the logger with the given logging configuration.
+// Initialize initializes the logger, its outputs, the access log and the request IDs
+// with the given logging configuration.
 func (c *Config) Initialize() error {
-	var opts slog.HandlerOptions
 	level, err := levelFromString(c.Level)
 	if err != nil {
 		return fmt.Errorf("%w: %w", errInvalidSettings, err)
 	}
-	opts.Level = level
 
-	handler, err := handlerFromString(c.Handler)
+	newHandler, err := handlerFromString(c.Handler)
 	if err != nil {
 		return fmt.Errorf("%w: %w", errInvalidSettings, err)
 	}
-	slog.SetDefault(slog.New(handler(&opts)))
+
+	overrides, err := parseOverrides(c.Services)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidSettings, err)
+	}
+
+	trusted, err := c.RequestID.parseTrustedIPs()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidSettings, err)
+	}
+
+	handler, closers, err := c.openOutputs(newHandler)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidSettings, err)
+	}
+
+	var access *AccessLogger
+	if c.Access != nil {
+		if access, err = NewAccessLogger(*c.Access); err != nil {
+			closeAll(closers)
+			return fmt.Errorf("%w: %w", errInvalidSettings, err)
+		}
+	}
+
+	globalLevel.Set(level)
+	configuredLevel.Store(int64(level))
+	slog.SetDefault(slog.New(newLevelHandler(handler, overrides)))
+	setOutputs(closers)
+	setAccess(access)
+	trustedIPs.Store(&trusted)
 
 	return nil
 }
+
+// openOutputs opens the outputs of the configuration, returning the handler that writes to all of them
+// along with what closes them.
+func (c *Config) openOutputs(newHandler func(io.Writer, *slog.HandlerOptions) slog.Handler) (
+	slog.Handler, []io.Closer, error,
+) {
+	configs := c.Outputs
+	if len(configs) == 0 {
+		configs = []OutputConfig{{Type: OutputStdout}}
+	}
+	opts := &slog.HandlerOptions{Level: allLevels}
+	var handlers multiHandler
+	var closers []io.Closer
+	for _, config := range configs {
+		handler, closer, err := newOutput(config, newHandler, opts)
+		if err != nil {
+			closeAll(closers)
+			return nil, nil, err
+		}
+		handlers = append(handlers, handler)
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+	}
+	if len(handlers) == 1 {
+		return handlers[0], closers, nil
+	}
+	return handlers, closers, nil
+}
+
+// closeAll closes the outputs that were opened before an error.
+func closeAll(closers []io.Closer) {
+	for _, closer := range closers {
+		closer.Close()
+	}
+}
@@ -86,8 +86,8 @@ func TestHandlerFromStringSuccess(t *testing.T) {
 				t.Fatalf("unexpected error: %s", err)
 			}
 
-			if !reflect.DeepEqual(handler(&opts), test.expectedHandler) {
-				t.Fatalf("expected handler %s, got %s", test.expectedHandler, handler(&opts))
+			if !reflect.DeepEqual(handler(os.Stdout, &opts), test.expectedHandler) {
+				t.Fatalf("expected handler %s, got %s", test.expectedHandler, handler(os.Stdout, &opts))
 			}
 		})
 	}
@@ -124,6 +124,22 @@ func TestConfigInitialize(t *testing.T) {
 			settings:    Config{Handler: "invalid"},
 			expectedErr: errInvalidSettings,
 		},
+		"access log": {
+			settings:    Config{Access: &AccessConfig{Format: FormatJSON}},
+			expectedErr: nil,
+		},
+		"invalid access log": {
+			settings:    Config{Access: &AccessConfig{Format: "invalid"}},
+			expectedErr: errInvalidSettings,
+		},
+		"trusted request ID addresses": {
+			settings:    Config{RequestID: RequestIDConfig{TrustedIPs: []string{"10.0.0.1", "192.0.2.0/24"}}},
+			expectedErr: nil,
+		},
+		"invalid trusted request ID address": {
+			settings:    Config{RequestID: RequestIDConfig{TrustedIPs: []string{"invalid"}}},
+			expectedErr: errInvalidSettings,
+		},
 	}
 
 	for name, test := range tests {
@@ -132,6 +148,9 @@ func TestConfigInitialize(t *testing.T) {
 			if !errors.Is(err, test.expectedErr) {
 				t.Fatalf("expected error %s, got %s", test.expectedErr, err)
 			}
+			if err == nil && (Access() != nil) != (test.settings.Access != nil) {
+				t.Errorf("expected access log %v, got %v", test.settings.Access, Access())
+			}
 		})
 	}
 }
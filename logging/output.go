@@ -0,0 +1,294 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Output types.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+// Networks of syslog servers.
+const (
+	NetworkUnix = "unix"
+	NetworkUDP  = "udp"
+)
+
+const (
+	defaultSyslogAddress = "/dev/log"
+	defaultSyslogTag     = "voltproxy"
+)
+
+// Syslog severities, and the facility of the messages, as defined by RFC 5424.
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+	facilityDaemon  = 3
+	facilityShift   = 3
+)
+
+var (
+	errInvalidOutput        = fmt.Errorf("invalid log output, must be one of: stdout, stderr, file, syslog")
+	errMissingOutputPath    = fmt.Errorf("file log output requires a path")
+	errInvalidSyslogNetwork = fmt.Errorf("invalid syslog network, must be one of: unix, udp")
+)
+
+// OutputConfig defines a destination of the logs.
+type OutputConfig struct {
+	// Type is stdout, stderr, file or syslog.
+	Type string `yaml:"type"`
+	// Path is the file the logs are written to if the type is file.
+	Path string `yaml:"path"`
+	// MaxSize is the size in megabytes after which the file is rotated. The file is not rotated by size if 0.
+	MaxSize int `yaml:"maxSize"`
+	// RotateInterval is how often the file is rotated. The file is not rotated by time if 0.
+	RotateInterval time.Duration `yaml:"rotateInterval"`
+	// MaxBackups is the number of rotated files that are kept. All of them are kept if 0.
+	MaxBackups int `yaml:"maxBackups"`
+	// Network is the network of the syslog server, unix or udp. Defaults to unix.
+	Network string `yaml:"network"`
+	// Address is the address of the syslog server, or the path of its socket if the network is unix.
+	// Defaults to /dev/log.
+	Address string `yaml:"address"`
+	// Tag identifies voltproxy in syslog messages. Defaults to voltproxy.
+	Tag string `yaml:"tag"`
+}
+
+// newOutput returns a handler that formats records with newHandler and writes them to the output,
+// along with what closes the output, if anything.
+func newOutput(c OutputConfig, newHandler func(io.Writer, *slog.HandlerOptions) slog.Handler,
+	opts *slog.HandlerOptions,
+) (slog.Handler, io.Closer, error) {
+	switch c.Type {
+	case OutputStdout, "":
+		return newHandler(os.Stdout, opts), nil, nil
+	case OutputStderr:
+		return newHandler(os.Stderr, opts), nil, nil
+	case OutputFile:
+		if c.Path == "" {
+			return nil, nil, errMissingOutputPath
+		}
+		file, err := openRotatingFile(c.Path, int64(c.MaxSize)*megabyte, c.RotateInterval, c.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newHandler(file, opts), file, nil
+	case OutputSyslog:
+		w, err := dialSyslog(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &syslogHandler{Handler: newHandler(w, opts), w: w}, w, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: got %s", errInvalidOutput, c.Type)
+	}
+}
+
+// outputs are the closers of the outputs set up by Initialize, which are closed when replaced.
+var outputs atomic.Pointer[[]io.Closer]
+
+// setOutputs replaces the closers of the outputs, closing the previous ones.
+func setOutputs(closers []io.Closer) {
+	previous := outputs.Swap(&closers)
+	if previous == nil {
+		return
+	}
+	for _, closer := range *previous {
+		if err := closer.Close(); err != nil {
+			slog.Warn("Error while closing log output", slog.Any("error", err))
+		}
+	}
+}
+
+// ReopenFiles reopens the files of the access log and of the file outputs,
+// e.g. after they have been moved by an external tool.
+func ReopenFiles() error {
+	var errs []error
+	if accessLog := Access(); accessLog != nil {
+		errs = append(errs, accessLog.Reopen())
+	}
+	if closers := outputs.Load(); closers != nil {
+		for _, closer := range *closers {
+			if file, ok := closer.(*rotatingFile); ok {
+				errs = append(errs, file.reopen())
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// multiHandler passes records to several handlers.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// syslogWriter sends each write as a syslog message, reconnecting if sending fails.
+type syslogWriter struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+	// severity is the severity of the next message, set by syslogHandler.
+	severity int
+}
+
+// dialSyslog connects to the syslog server of the output.
+func dialSyslog(c OutputConfig) (*syslogWriter, error) {
+	w := &syslogWriter{network: c.Network, address: c.Address, tag: c.Tag, severity: severityInfo}
+	switch w.network {
+	case NetworkUnix, "":
+		w.network = NetworkUnix
+		if w.address == "" {
+			w.address = defaultSyslogAddress
+		}
+	case NetworkUDP:
+	default:
+		return nil, fmt.Errorf("%w: got %s", errInvalidSyslogNetwork, c.Network)
+	}
+	if w.tag == "" {
+		w.tag = defaultSyslogTag
+	}
+	w.hostname, _ = os.Hostname()
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// connect connects to the syslog server. Unix sockets are tried as datagram sockets first, then as stream sockets.
+func (w *syslogWriter) connect() error {
+	if w.network != NetworkUnix {
+		conn, err := net.Dial(w.network, w.address)
+		w.conn = conn
+		return err
+	}
+	var err error
+	for _, network := range []string{"unixgram", "unix"} {
+		if w.conn, err = net.Dial(network, w.address); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Write sends a message with the current severity. The caller must hold the lock.
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	priority := facilityDaemon<<facilityShift | w.severity
+	var msg string
+	if w.network == NetworkUnix {
+		// The local syslog daemon adds the hostname.
+		msg = fmt.Sprintf("<%d>%s %s[%d]: %s", priority, time.Now().Format(time.Stamp), w.tag, os.Getpid(), p)
+	} else {
+		msg = fmt.Sprintf("<%d>%s %s %s[%d]: %s",
+			priority, time.Now().Format(time.RFC3339), w.hostname, w.tag, os.Getpid(), p)
+	}
+	if w.conn != nil {
+		if _, err := io.WriteString(w.conn, msg); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+	}
+	if err := w.connect(); err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(w.conn, msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to the syslog server.
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+// severity returns the syslog severity of a level.
+func severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return severityError
+	case level >= slog.LevelWarn:
+		return severityWarning
+	case level >= slog.LevelInfo:
+		return severityInfo
+	default:
+		return severityDebug
+	}
+}
+
+// syslogHandler writes records to syslog with the severity of their level.
+type syslogHandler struct {
+	slog.Handler
+	w *syslogWriter
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.severity = severity(r.Level)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewOutputErrors(t *testing.T) {
+	tests := map[string]struct {
+		config   OutputConfig
+		expected error
+	}{
+		"invalid type":      {config: OutputConfig{Type: "invalid"}, expected: errInvalidOutput},
+		"file without path": {config: OutputConfig{Type: OutputFile}, expected: errMissingOutputPath},
+		"invalid syslog network": {
+			config:   OutputConfig{Type: OutputSyslog, Network: "tcp"},
+			expected: errInvalidSyslogNetwork,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			newHandler, err := handlerFromString("text")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := newOutput(test.config, newHandler, nil); !errors.Is(err, test.expected) {
+				t.Errorf("expected error %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestFileOutputs(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.log"), filepath.Join(dir, "second.log")
+	c := Config{Outputs: []OutputConfig{{Type: OutputFile, Path: first}, {Type: OutputFile, Path: second}}}
+	if err := c.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = (&Config{}).Initialize() }()
+
+	slog.Info("Before reopening")
+	if err := os.Rename(first, first+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReopenFiles(); err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("After reopening")
+
+	expected := map[string][]string{
+		first + ".old": {"Before reopening"},
+		first:          {"After reopening"},
+		second:         {"Before reopening", "After reopening"},
+	}
+	for path, messages := range expected {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(b), "\n"); lines != len(messages) {
+			t.Errorf("%s: expected %d lines, got %q", path, len(messages), b)
+		}
+		for _, message := range messages {
+			if !strings.Contains(string(b), message) {
+				t.Errorf("%s: expected %q, got %q", path, message, b)
+			}
+		}
+	}
+}
+
+func TestSyslogOutput(t *testing.T) {
+	listen := map[string]func(t *testing.T) (net.PacketConn, OutputConfig){
+		"udp": func(t *testing.T) (net.PacketConn, OutputConfig) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return conn, OutputConfig{Type: OutputSyslog, Network: NetworkUDP, Address: conn.LocalAddr().String()}
+		},
+		"unix": func(t *testing.T) (net.PacketConn, OutputConfig) {
+			path := filepath.Join(t.TempDir(), "log")
+			conn, err := net.ListenPacket("unixgram", path)
+			if err != nil {
+				t.Skipf("unix datagram sockets are not supported: %v", err)
+			}
+			return conn, OutputConfig{Type: OutputSyslog, Address: path, Tag: "proxy"}
+		},
+	}
+
+	for name, listen := range listen {
+		t.Run(name, func(t *testing.T) {
+			conn, output := listen(t)
+			defer conn.Close()
+			if err := (&Config{Outputs: []OutputConfig{output}}).Initialize(); err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = (&Config{}).Initialize() }()
+
+			slog.Warn("Something happened")
+			if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 1024)
+			n, _, err := conn.ReadFrom(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := string(b[:n])
+			tag := output.Tag
+			if tag == "" {
+				tag = defaultSyslogTag
+			}
+			// The priority of a warning of the daemon facility is 3*8+4.
+			if !strings.HasPrefix(msg, "<28>") || !strings.Contains(msg, " "+tag+"[") ||
+				!strings.Contains(msg, "Something happened") {
+				t.Errorf("expected syslog warning, got %q", msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+)
+
+// RequestIDHeader is the header carrying the ID of a request,
+// which is sent to backends and authentication servers and returned to the client.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength is the maximum length of a request ID that is reused from a trusted client.
+const maxRequestIDLength = 200
+
+// Printable ASCII characters allowed in a reused request ID, which excludes spaces.
+const (
+	minRequestIDChar = '!'
+	maxRequestIDChar = '~'
+)
+
+// Version and variant bits of a version 4 UUID.
+const (
+	uuidVersionMask = 0x0f
+	uuidVersion4    = 0x40
+	uuidVariantMask = 0x3f
+	uuidVariant     = 0x80
+)
+
+var errInvalidTrustedIP = fmt.Errorf("invalid trusted request ID address")
+
+// RequestIDConfig defines the configuration for request IDs.
+type RequestIDConfig struct {
+	// TrustedIPs are the addresses, in CIDR notation or not, whose X-Request-Id header is reused
+	// instead of generating a new request ID, e.g. those of load balancers in front of voltproxy.
+	TrustedIPs []string `yaml:"trustedIPs"`
+}
+
+// parseTrustedIPs parses the trusted addresses of the configuration as prefixes.
+func (c RequestIDConfig) parseTrustedIPs() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedIPs))
+	for _, ip := range c.TrustedIPs {
+		prefix, err := netip.ParsePrefix(ip)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(ip)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%w: got %s", errInvalidTrustedIP, ip)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// trustedIPs are the prefixes of the addresses whose request IDs are reused, as set up by Initialize.
+var trustedIPs atomic.Pointer[[]netip.Prefix]
+
+// trusted returns whether the remote address of a request is trusted to send its own request ID.
+func trusted(remoteAddr string) bool {
+	prefixes := trustedIPs.Load()
+	if prefixes == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range *prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// validRequestID returns whether a request ID is short and only made of printable characters,
+// so that it can be safely written to logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < minRequestIDChar || id[i] > maxRequestIDChar {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random version 4 UUID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&uuidVersionMask | uuidVersion4
+	b[8] = b[8]&uuidVariantMask | uuidVariant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// RequestID returns the ID of a request: its X-Request-Id header if it is valid and was sent
+// from a trusted address, or a newly generated one otherwise.
+func RequestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) && trusted(r.RemoteAddr) {
+		return id
+	}
+	return newRequestID()
+}
+
+// RequestLogger returns the default logger with the ID of the request, as set in its X-Request-Id header
+// by the proxy, so that every record emitted while handling the request can be correlated.
+func RequestLogger(r *http.Request) *slog.Logger {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		return slog.Default()
+	}
+	return slog.Default().With(slog.String(requestIDKey, id))
+}
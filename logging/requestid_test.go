@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	tests := map[string]struct {
+		trustedIPs []string
+		remoteAddr string
+		header     string
+		reused     bool
+	}{
+		"no header": {
+			trustedIPs: []string{"192.0.2.1"},
+			remoteAddr: "192.0.2.1:1234",
+			header:     "",
+			reused:     false,
+		},
+		"untrusted": {
+			trustedIPs: nil,
+			remoteAddr: "192.0.2.1:1234",
+			header:     "abc",
+			reused:     false,
+		},
+		"trusted address": {
+			trustedIPs: []string{"192.0.2.1"},
+			remoteAddr: "192.0.2.1:1234",
+			header:     "abc",
+			reused:     true,
+		},
+		"trusted network": {
+			trustedIPs: []string{"10.0.0.0/8", "192.0.2.0/24"},
+			remoteAddr: "192.0.2.7:1234",
+			header:     "abc",
+			reused:     true,
+		},
+		"trusted IPv4-mapped address": {
+			trustedIPs: []string{"192.0.2.0/24"},
+			remoteAddr: "[::ffff:192.0.2.7]:1234",
+			header:     "abc",
+			reused:     true,
+		},
+		"outside trusted network": {
+			trustedIPs: []string{"192.0.2.0/24"},
+			remoteAddr: "198.51.100.1:1234",
+			header:     "abc",
+			reused:     false,
+		},
+		"invalid characters": {
+			trustedIPs: []string{"192.0.2.1"},
+			remoteAddr: "192.0.2.1:1234",
+			header:     "abc def",
+			reused:     false,
+		},
+		"too long": {
+			trustedIPs: []string{"192.0.2.1"},
+			remoteAddr: "192.0.2.1:1234",
+			header:     strings.Repeat("a", maxRequestIDLength+1),
+			reused:     false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			prefixes, err := RequestIDConfig{TrustedIPs: test.trustedIPs}.parseTrustedIPs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			trustedIPs.Store(&prefixes)
+			defer trustedIPs.Store(nil)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			r.Header.Set(RequestIDHeader, test.header)
+
+			id := RequestID(r)
+			if test.reused && id != test.header {
+				t.Errorf("expected %s, got %s", test.header, id)
+			}
+			if !test.reused && !uuidPattern.MatchString(id) {
+				t.Errorf("expected generated request ID, got %s", id)
+			}
+		})
+	}
+}
+
+func TestParseTrustedIPsError(t *testing.T) {
+	_, err := RequestIDConfig{TrustedIPs: []string{"192.0.2.0/24", "invalid"}}.parseTrustedIPs()
+	if !errors.Is(err, errInvalidTrustedIP) {
+		t.Fatalf("expected error %s, got %s", errInvalidTrustedIP, err)
+	}
+}
+
+func TestNewRequestIDUnique(t *testing.T) {
+	if a, b := newRequestID(), newRequestID(); a == b {
+		t.Fatalf("expected different request IDs, got %s twice", a)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+	var b bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&b, nil)))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	RequestLogger(r).With(slog.String("host", "example.com")).Info("Handling request")
+
+	var record map[string]any
+	if err := json.Unmarshal(b.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["requestID"] != "abc" {
+		t.Errorf("expected request ID abc, got %v", record["requestID"])
+	}
+}
@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the time format of the suffix of rotated files, which sorts them by age.
+const backupTimeFormat = "20060102T150405.000"
+
+// logFileMode is the mode of created log files.
+const logFileMode = 0o644
+
+// rotatingFile is a file that is rotated once it exceeds a size or an age.
+// Rotated files are renamed with the time of their rotation as a suffix.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	now        func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// openRotatingFile opens a file that is rotated once it exceeds maxSize bytes or is older than interval.
+// Rotation by size or by time is disabled if maxSize or interval is 0.
+func openRotatingFile(path string, maxSize int64, interval time.Duration, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, interval: interval, maxBackups: maxBackups, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the file for appending, and only then closes the previous handle, if any,
+// so that logs can still be written if the file cannot be opened.
+// The caller must hold the lock, unless the file is being created.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, logFileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	previous := f.file
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	if previous == nil {
+		return nil
+	}
+	// The previous handle is already closed if the file was closed before being reopened.
+	if err := previous.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// Write writes to the file, rotating it first if the write would exceed the maximum size or the file is too old.
+// If rotating fails, p is still written and the error is returned, after which rotation is only retried
+// once the file exceeds the maximum size or the interval again, so that the error is reported once.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tooBig := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	tooOld := f.interval > 0 && f.now().Sub(f.opened) >= f.interval
+	var rotateErr error
+	if tooBig || tooOld {
+		if rotateErr = f.rotate(); rotateErr != nil {
+			f.size, f.opened = 0, f.now()
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+// rotate renames the file, opens a new one and removes the oldest rotated files. The caller must hold the lock.
+// If the file cannot be renamed or opened, logs keep being written to the current file.
+func (f *rotatingFile) rotate() error {
+	if err := os.Rename(f.path, f.path+"."+f.now().Format(backupTimeFormat)); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.removeOldBackups()
+}
+
+// removeOldBackups removes the oldest rotated files that exceed the maximum number of backups.
+func (f *rotatingFile) removeOldBackups() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	slices.Sort(backups)
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// reopen reopens the file, e.g. after it has been moved by an external tool.
+func (f *rotatingFile) reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.open()
+}
+
+// Close closes the file.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+	f, err := openRotatingFile(path, 10, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	writes := []struct {
+		data    string
+		advance time.Duration
+	}{
+		{data: "12345"},
+		{data: "67890"},
+		// Exceeds the maximum size.
+		{data: "a", advance: time.Second},
+		// Exceeds the interval.
+		{data: "b", advance: time.Hour},
+		{data: "c", advance: time.Hour},
+	}
+	for _, w := range writes {
+		now = now.Add(w.advance)
+		if _, err := f.Write([]byte(w.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	// The first rotated file was removed as only two backups are kept.
+	expected := []string{"access.log", "access.log.20240305T153001.000", "access.log.20240305T163001.000"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("expected files %v, got %v", expected, names)
+	}
+	for name, content := range map[string]string{
+		"access.log":                     "c",
+		"access.log.20240305T153001.000": "a",
+		"access.log.20240305T163001.000": "b",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+	f, err := openRotatingFile(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.opened = now
+
+	// A non-empty directory in place of the rotated file makes renaming fail.
+	backup := path + "." + now.Add(time.Hour).Format(backupTimeFormat)
+	if err := os.MkdirAll(filepath.Join(backup, "occupied"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	if n, err := f.Write([]byte("a")); n != 1 || err == nil {
+		t.Fatalf("expected the write to succeed and the rotation error to be reported, got %d (error %v)", n, err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "a" {
+		t.Errorf("expected %q, got %q (error %v)", "a", got, err)
+	}
+	// The rotation is not retried, nor its error reported, until the file is due for rotation again.
+	now = now.Add(time.Minute)
+	if _, err := f.Write([]byte("b")); err != nil {
+		t.Fatalf("expected rotation to back off, got %v", err)
+	}
+	if err := f.reopen(); err != nil {
+		t.Fatalf("expected reopen to succeed, got %v", err)
+	}
+
+	// The file can be reopened after being closed, e.g. when its output is replaced.
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.reopen(); err != nil {
+		t.Fatalf("expected reopen of a closed file to succeed, got %v", err)
+	}
+	if _, err := f.Write([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "abc" {
+		t.Errorf("expected %q, got %q (error %v)", "abc", got, err)
+	}
+}
@@ -2,19 +2,29 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/plamorg/voltproxy/admin"
 	"github.com/plamorg/voltproxy/config"
 	"github.com/plamorg/voltproxy/dockerapi"
 	"github.com/plamorg/voltproxy/services"
 )
 
+const configPath = "./config.yml"
+
+var errHostNotConfigured = fmt.Errorf("host is not configured for TLS")
+
 func listen(handler http.Handler, timeout time.Duration) {
 	server := &http.Server{
 		Addr:        ":http",
@@ -38,26 +48,103 @@ func listenTLS(handler http.Handler, timeout time.Duration, tlsConfig *tls.Confi
 	os.Exit(1)
 }
 
+func listenAdmin(server *admin.Server, timeout time.Duration) {
+	adminServer := &http.Server{
+		Addr:        server.Address,
+		Handler:     server,
+		ReadTimeout: timeout,
+	}
+	slog.Error("Error from admin server", slog.Any("error", adminServer.ListenAndServe()))
+	os.Exit(1)
+}
+
 func logPanic(msg string, err error) {
 	slog.Error(msg, slog.Any("error", err))
 	os.Exit(1)
 }
 
-func main() {
-	confContent, err := os.ReadFile("./config.yml")
+func readConfig() (*config.Config, error) {
+	confContent, err := os.ReadFile(configPath)
 	if err != nil {
-		logPanic("Error while reading configuration file", err)
+		return nil, err
 	}
+	return config.New(confContent)
+}
 
-	conf, err := config.New(confContent)
+// proxy holds the services being proxied, which are replaced when the configuration is reloaded.
+type proxy struct {
+	docker   dockerapi.Docker
+	registry *services.Registry
+	tlsHosts atomic.Pointer[[]string]
+	// mu ensures that only one configuration is loaded at a time.
+	mu sync.Mutex
+}
+
+// load starts proxying the services of a configuration and stops the health checks of the services they replace.
+func (p *proxy) load(conf *config.Config) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	serviceMap, err := conf.Services(p.docker)
 	if err != nil {
-		logPanic("Error while parsing configuration file", err)
+		return fmt.Errorf("error while fetching services: %w", err)
+	}
+	notifier, err := conf.Notifier()
+	if err != nil {
+		return fmt.Errorf("error while creating notifiers: %w", err)
+	}
+
+	services.InheritHealth(serviceMap, p.registry.Services())
+	services.LaunchHealthChecks(serviceMap, notifier)
+	tlsHosts := conf.TLSHosts()
+	p.tlsHosts.Store(&tlsHosts)
+	services.StopHealthChecks(p.registry.Replace(serviceMap))
+	slog.Info("Managing certificates", slog.Any("hosts", tlsHosts))
+	return nil
+}
+
+// reload reloads the services of the configuration file.
+// Other settings, such as logging and the admin API, only change on restart.
+func (p *proxy) reload() error {
+	conf, err := readConfig()
+	if err != nil {
+		slog.Warn("Error while reloading configuration file", slog.Any("error", err))
+		return err
+	}
+	if err := p.load(conf); err != nil {
+		slog.Warn("Error while reloading configuration file", slog.Any("error", err))
+		return err
+	}
+	slog.Info("Reloaded configuration file")
+	return nil
+}
+
+// hostPolicy only allows certificates for the hosts that currently require TLS.
+func (p *proxy) hostPolicy(_ context.Context, host string) error {
+	if !slices.Contains(*p.tlsHosts.Load(), host) {
+		return fmt.Errorf("%w: %s", errHostNotConfigured, host)
+	}
+	return nil
+}
+
+func main() {
+	conf, err := readConfig()
+	if err != nil {
+		logPanic("Error while reading configuration file", err)
 	}
 
 	if err = conf.LogConfig.Initialize(); err != nil {
 		logPanic("Error while initializing logging", err)
 	}
 	slog.Info("Logging enabled", slog.Any("logger", conf.LogConfig))
+	handleLogSignals()
+
+	if err = conf.Tracing.Initialize(); err != nil {
+		logPanic("Error while initializing tracing", err)
+	}
+	if conf.Tracing != nil {
+		slog.Info("Tracing enabled", slog.Any("tracing", *conf.Tracing))
+	}
 
 	docker, err := dockerapi.NewClient()
 	if err != nil {
@@ -65,22 +152,27 @@ func main() {
 	}
 	slog.Info("Connected to Docker", slog.Any("docker", docker))
 
-	serviceMap, err := conf.Services(docker)
-	if err != nil {
-		logPanic("Error while fetching services", err)
+	p := &proxy{docker: docker, registry: services.NewRegistry(nil)}
+	if err = p.load(conf); err != nil {
+		logPanic("Error while loading services", err)
 	}
 
-	services.LaunchHealthChecks(serviceMap)
-
-	tlsHosts := conf.TLSHosts()
-	slog.Info("Managing certificates", slog.Any("hosts", tlsHosts))
 	certManager := autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(tlsHosts...),
+		HostPolicy: p.hostPolicy,
 		Cache:      autocert.DirCache("_certs"),
 	}
 
+	if conf.Admin != nil {
+		adminServer, err := admin.New(*conf.Admin, p.registry, p.reload, certManager.Cache)
+		if err != nil {
+			logPanic("Error while creating admin API", err)
+		}
+		slog.Info("Serving admin API", slog.String("address", adminServer.Address))
+		go listenAdmin(adminServer, conf.ReadTimeout)
+	}
+
 	slog.Info("Accepting connections on :80 and :443")
-	go listen(certManager.HTTPHandler(services.Handler(serviceMap)), conf.ReadTimeout)
-	listenTLS(services.TLSHandler(serviceMap), conf.ReadTimeout, certManager.TLSConfig())
+	go listen(certManager.HTTPHandler(p.registry.Handler()), conf.ReadTimeout)
+	listenTLS(p.registry.TLSHandler(), conf.ReadTimeout, certManager.TLSConfig())
 }
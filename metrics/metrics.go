@@ -0,0 +1,156 @@
+// Package metrics provides counters, gauges and histograms that are exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the content type of the Prometheus text format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of histogram buckets suited to request latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry of the metrics recorded by the proxy.
+var Default = NewRegistry()
+
+// family is a group of metrics with the same name and labels.
+type family interface {
+	name() string
+	write(b *bytes.Buffer)
+}
+
+// desc describes a family of metrics.
+type desc struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+}
+
+func newDesc(name, help, kind string, labels []string) desc {
+	return desc{metricName: name, help: help, kind: kind, labels: labels}
+}
+
+func (d *desc) name() string {
+	return d.metricName
+}
+
+func (d *desc) writeHeader(b *bytes.Buffer) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, escapeHelp(d.help), d.metricName, d.kind)
+}
+
+// key returns the key of the metric with the given label values.
+// It panics if the number of label values does not match the labels of the family.
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", d.metricName, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// writeSample writes a sample of a metric with the given label values.
+// Histograms give the upper bound of a bucket as an extra le label.
+func (d *desc) writeSample(b *bytes.Buffer, suffix string, labelValues []string, value float64, le ...string) {
+	b.WriteString(d.metricName)
+	b.WriteString(suffix)
+	names, values := d.labels, labelValues
+	if len(le) > 0 {
+		names = append(slices.Clip(names), "le")
+		values = append(slices.Clip(values), le...)
+	}
+	if len(names) > 0 {
+		b.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, name, labelEscaper.Replace(values[i]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatValue(value))
+	b.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// Registry holds families of metrics.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register adds a family to the registry. It panics if a family with the same name is already registered.
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, registered := range r.families {
+		if registered.name() == f.name() {
+			panic(fmt.Sprintf("metric %s is already registered", f.name()))
+		}
+	}
+	r.families = append(r.families, f)
+}
+
+// WriteTo writes the metrics of the registry in the Prometheus text format, ordered by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+	slices.SortFunc(families, func(a, b family) int {
+		return strings.Compare(a.name(), b.name())
+	})
+
+	var b bytes.Buffer
+	for _, f := range families {
+		f.write(&b)
+	}
+	return b.WriteTo(w)
+}
+
+// Handler returns a http.Handler that serves the metrics of the registries.
+func Handler(registries ...*Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		for _, r := range registries {
+			if _, err := r.WriteTo(w); err != nil {
+				slog.Warn("Error while writing metrics", slog.Any("error", err))
+				return
+			}
+		}
+	})
+}
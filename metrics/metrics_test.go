@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Number of requests.", "service", "code")
+	inFlight := r.NewGauge("test_in_flight", "Requests in flight.")
+	latency := r.NewHistogram("test_latency_seconds", "Latency.", []float64{1, 0.1}, "service")
+	r.NewGaugeFunc("test_up", "Whether a service is up.", []string{"service"},
+		func(emit func(value float64, labelValues ...string)) {
+			emit(1, "b")
+			emit(0, "a")
+		})
+
+	requests.Inc("foo", "200")
+	requests.Add(2, "foo", "200")
+	requests.Inc(`quote"d\`, "500")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.Observe(0.05, "foo")
+	latency.Observe(0.1, "foo")
+	latency.Observe(0.5, "foo")
+	latency.Observe(2, "foo")
+
+	expected := `# HELP test_in_flight Requests in flight.
+# TYPE test_in_flight gauge
+test_in_flight 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{service="foo",le="0.1"} 2
+test_latency_seconds_bucket{service="foo",le="1"} 3
+test_latency_seconds_bucket{service="foo",le="+Inf"} 4
+test_latency_seconds_sum{service="foo"} 2.65
+test_latency_seconds_count{service="foo"} 4
+# HELP test_requests_total Number of requests.
+# TYPE test_requests_total counter
+test_requests_total{service="foo",code="200"} 3
+test_requests_total{service="quote\"d\\",code="500"} 1
+# HELP test_up Whether a service is up.
+# TYPE test_up gauge
+test_up{service="a"} 0
+test_up{service="b"} 1
+`
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != expected {
+		t.Errorf("expected %s, got %s", expected, b.String())
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on duplicate metric")
+		}
+	}()
+	r.NewGauge("test_total", "Test.")
+}
+
+func TestWrongLabelValues(t *testing.T) {
+	c := NewRegistry().NewCounter("test_total", "Test.", "service")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on wrong number of label values")
+		}
+	}()
+	c.Inc("foo", "bar")
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := map[float64]string{
+		1:            "1",
+		0.25:         "0.25",
+		1e21:         "1e+21",
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+	}
+	for value, expected := range tests {
+		if got := formatValue(value); got != expected {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	first, second := NewRegistry(), NewRegistry()
+	first.NewCounter("first_total", "First.").Inc()
+	second.NewCounter("second_total", "Second.").Inc()
+
+	w := httptest.NewRecorder()
+	Handler(first, second).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Header().Get("Content-Type") != contentType {
+		t.Errorf("expected %s, got %s", contentType, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.String(); !strings.Contains(body, "first_total 1\n") || !strings.Contains(body, "second_total 1\n") {
+		t.Errorf("expected metrics of both registries, got %s", body)
+	}
+}
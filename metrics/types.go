@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+)
+
+// Metric kinds.
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// sample is the value of a metric with particular label values.
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// values holds the values of a family of counters or gauges by label values.
+type values struct {
+	desc
+
+	mu      sync.Mutex
+	samples map[string]*sample
+}
+
+func (v *values) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.samples[key]
+	if !ok {
+		s = &sample{labelValues: slices.Clone(labelValues)}
+		v.samples[key] = s
+	}
+	s.value += delta
+}
+
+func (v *values) set(value float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.samples[key] = &sample{labelValues: slices.Clone(labelValues), value: value}
+}
+
+func (v *values) write(b *bytes.Buffer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeHeader(b)
+	for _, key := range sortedKeys(v.samples) {
+		s := v.samples[key]
+		v.writeSample(b, "", s.labelValues, s.value)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Counter is a family of values that only increase, such as the number of requests.
+type Counter struct {
+	values
+}
+
+// NewCounter creates and registers a counter with the given labels.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{values{desc: newDesc(name, help, kindCounter, labels), samples: make(map[string]*sample)}}
+	r.register(c)
+	return c
+}
+
+// Add adds a non-negative value to the counter with the given label values.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.add(value, labelValues)
+}
+
+// Inc increments the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Gauge is a family of values that can go up and down, such as the number of requests in flight.
+type Gauge struct {
+	values
+}
+
+// NewGauge creates and registers a gauge with the given labels.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{values{desc: newDesc(name, help, kindGauge, labels), samples: make(map[string]*sample)}}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge with the given label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+// Add adds a value, which may be negative, to the gauge with the given label values.
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.add(value, labelValues)
+}
+
+// Inc increments the gauge with the given label values.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+// Dec decrements the gauge with the given label values.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+// GaugeFunc is a family of gauges whose values are collected whenever the metrics are written.
+type GaugeFunc struct {
+	desc
+
+	collect func(emit func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc creates and registers gauges with the given labels, whose values are emitted by collect.
+func (r *Registry) NewGaugeFunc(
+	name, help string,
+	labels []string,
+	collect func(emit func(value float64, labelValues ...string)),
+) *GaugeFunc {
+	g := &GaugeFunc{desc: newDesc(name, help, kindGauge, labels), collect: collect}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(b *bytes.Buffer) {
+	var samples []sample
+	g.collect(func(value float64, labelValues ...string) {
+		g.key(labelValues) // Panics if the label values do not match the labels.
+		samples = append(samples, sample{labelValues: labelValues, value: value})
+	})
+	slices.SortStableFunc(samples, func(a, b sample) int {
+		return slices.Compare(a.labelValues, b.labelValues)
+	})
+	g.writeHeader(b)
+	for _, s := range samples {
+		g.writeSample(b, "", s.labelValues, s.value)
+	}
+}
+
+// histogramSample is the distribution of the observations with particular label values.
+type histogramSample struct {
+	labelValues []string
+	// counts are the number of observations in each bucket, which are not cumulative.
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histogram is a family of distributions of observations, such as request latencies, in buckets.
+type Histogram struct {
+	desc
+
+	buckets []float64
+	mu      sync.Mutex
+	samples map[string]*histogramSample
+}
+
+// NewHistogram creates and registers a histogram with the given bucket upper bounds and labels.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    newDesc(name, help, kindHistogram, labels),
+		buckets: slices.Clone(buckets),
+		samples: make(map[string]*histogramSample),
+	}
+	slices.Sort(h.buckets)
+	r.register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.samples[key]
+	if !ok {
+		s = &histogramSample{labelValues: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.samples[key] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(b *bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(b)
+	for _, key := range sortedKeys(h.samples) {
+		s := h.samples[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			h.writeSample(b, "_bucket", s.labelValues, float64(cumulative), formatValue(upper))
+		}
+		h.writeSample(b, "_bucket", s.labelValues, float64(s.count), "+Inf")
+		h.writeSample(b, "_sum", s.labelValues, s.sum)
+		h.writeSample(b, "_count", s.labelValues, float64(s.count))
+	}
+}
@@ -3,6 +3,9 @@ package middlewares
 import (
 	"log/slog"
 	"net/http"
+
+	"github.com/plamorg/voltproxy/logging"
+	"github.com/plamorg/voltproxy/tracing"
 )
 
 // AuthForward is a middleware that forwards the request to an authentication server and
@@ -26,7 +29,7 @@ type AuthForward struct {
 // authentication is successful.
 func (a *AuthForward) Handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := slog.Default().With(
+		logger := logging.RequestLogger(r).With(
 			slog.String("host", r.Host),
 			slog.Any("authForward", a))
 
@@ -48,6 +51,11 @@ func (a *AuthForward) Handle(next http.Handler) http.Handler {
 			for _, header := range a.RequestHeaders {
 				authReq.Header.Set(header, r.Header.Get(header))
 			}
+			// The request ID is always forwarded so that the request can be correlated with the logs
+			// of the authentication server.
+			if requestID := r.Header.Get(logging.RequestIDHeader); requestID != "" {
+				authReq.Header.Set(logging.RequestIDHeader, requestID)
+			}
 		}
 
 		if a.XForwarded {
@@ -58,7 +66,9 @@ func (a *AuthForward) Handle(next http.Handler) http.Handler {
 			}
 		}
 
+		// The request to the authentication server is traced as part of the request it authenticates.
 		noRedirectClient := &http.Client{
+			Transport: tracing.Transport("authForward request", http.DefaultTransport),
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse
 			},
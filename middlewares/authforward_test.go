@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/plamorg/voltproxy/logging"
 )
 
 var teapotHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -63,6 +65,9 @@ func TestAuthForwardHandleRequestHeaders(t *testing.T) {
 		if r.Header.Get("Not-Forwarded") != "" {
 			t.Errorf("header was unexpectedly forwarded")
 		}
+		if r.Header.Get(logging.RequestIDHeader) != testValue {
+			t.Errorf("request ID was not forwarded")
+		}
 
 		w.WriteHeader(http.StatusOK)
 	}))
@@ -77,6 +82,7 @@ func TestAuthForwardHandleRequestHeaders(t *testing.T) {
 	w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)
 	r.Header.Set("Test-Header", testValue)
 	r.Header.Set("Not-Forwarded", "do not forward")
+	r.Header.Set(logging.RequestIDHeader, testValue)
 	handler.ServeHTTP(w, r)
 
 	if w.Code != http.StatusTeapot {
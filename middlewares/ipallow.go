@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+
+	"github.com/plamorg/voltproxy/logging"
 )
 
 // IPAllow is a middleware that only allows requests from a list of IP addresses.
@@ -19,7 +21,7 @@ func NewIPAllow(allowedIPs []string) *IPAllow {
 // If the remote address is not in the allowed IP addresses, it returns a 403 Forbidden.
 func (ip *IPAllow) Handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := slog.Default().With(
+		logger := logging.RequestLogger(r).With(
 			slog.String("host", r.Host),
 			slog.Group("ipAllow",
 				slog.Any("allowedIPs", *ip),
@@ -2,6 +2,7 @@
 package middlewares
 
 import (
+	"fmt"
 	"net/http"
 	"reflect"
 )
@@ -33,3 +34,17 @@ func (c *Middlewares) List() []Middleware {
 type Middleware interface {
 	Handle(next http.Handler) http.Handler
 }
+
+// Name returns the name of a middleware as given in the configuration.
+func Name(middleware Middleware) string {
+	switch middleware.(type) {
+	case *IPAllow:
+		return "ipAllow"
+	case *AuthForward:
+		return "authForward"
+	case *XForward:
+		return "xForward"
+	default:
+		return fmt.Sprintf("%T", middleware)
+	}
+}
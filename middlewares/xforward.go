@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+
+	"github.com/plamorg/voltproxy/logging"
 )
 
 const (
@@ -45,7 +47,7 @@ func xForward(newReq *http.Request, r http.Request) {
 // Handle adds X-Forwarded headers to the request.
 func (x *XForward) Handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := slog.Default().With(
+		logger := logging.RequestLogger(r).With(
 			slog.String("host", r.Host),
 			slog.Any("xForward", x))
 
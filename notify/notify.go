@@ -0,0 +1,100 @@
+// Package notify provides notifications of services changing between up and down.
+package notify
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event describes a service that changed between up and down.
+type Event struct {
+	Host     string    `json:"host"`
+	Service  string    `json:"service"`
+	State    string    `json:"state"`
+	Previous string    `json:"previous"`
+	Endpoint string    `json:"endpoint"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Notifier sends notifications of events.
+// Implementations must be safe for concurrent use and must not block.
+type Notifier interface {
+	Notify(event Event)
+}
+
+// Debouncer delays notifications of a service until its state has been stable for a period,
+// so that a flapping service does not send a notification on every change.
+// Changes that are undone within the period are not notified at all.
+type Debouncer struct {
+	next   Notifier
+	period time.Duration
+
+	mu      sync.Mutex
+	pending map[serviceKey]*pendingEvent
+}
+
+// serviceKey identifies the service of an event. Load balancer members may have no host,
+// so services are identified by both their host and their name.
+type serviceKey struct {
+	host    string
+	service string
+}
+
+type pendingEvent struct {
+	event Event
+	timer *time.Timer
+}
+
+// NewDebouncer creates a Debouncer that forwards stable events to next.
+func NewDebouncer(next Notifier, period time.Duration) *Debouncer {
+	return &Debouncer{
+		next:    next,
+		period:  period,
+		pending: make(map[serviceKey]*pendingEvent),
+	}
+}
+
+// Notify schedules the event to be forwarded once the period has passed without another change.
+func (d *Debouncer) Notify(event Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := serviceKey{host: event.Host, service: event.Service}
+	if p, ok := d.pending[key]; ok {
+		p.timer.Stop()
+		delete(d.pending, key)
+		// The previous state of the pending event is the state that was last notified.
+		event.Previous = p.event.Previous
+		if event.State == event.Previous {
+			slog.Debug("Dropping notification of flapping service",
+				slog.String("host", event.Host), slog.String("service", event.Service),
+				slog.String("state", event.State))
+			return
+		}
+	}
+
+	p := &pendingEvent{event: event}
+	p.timer = time.AfterFunc(d.period, func() {
+		d.mu.Lock()
+		if d.pending[key] != p {
+			d.mu.Unlock()
+			return
+		}
+		delete(d.pending, key)
+		d.mu.Unlock()
+		d.next.Notify(event)
+	})
+	d.pending[key] = p
+}
+
+// Multi is a Notifier that notifies multiple notifiers.
+type Multi []Notifier
+
+// Notify notifies every notifier.
+func (m Multi) Notify(event Event) {
+	for _, n := range m {
+		n.Notify(event)
+	}
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a notifier that records events.
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Notify(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) states() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var states []string
+	for _, event := range r.events {
+		states = append(states, event.Previous+"->"+event.State)
+	}
+	return states
+}
+
+func TestDebouncer(t *testing.T) {
+	tests := map[string]struct {
+		changes  [][2]string
+		expected []string
+	}{
+		"single change": {
+			changes:  [][2]string{{"up", "down"}},
+			expected: []string{"up->down"},
+		},
+		"undone change": {
+			changes: [][2]string{{"up", "down"}, {"down", "up"}},
+		},
+		"flapping": {
+			changes:  [][2]string{{"up", "down"}, {"down", "up"}, {"up", "down"}},
+			expected: []string{"up->down"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := &recorder{}
+			d := NewDebouncer(r, 50*time.Millisecond)
+			for _, change := range test.changes {
+				d.Notify(Event{Host: "example.com", Previous: change[0], State: change[1]})
+			}
+			if states := r.states(); len(states) != 0 {
+				t.Fatalf("expected no notifications before the debounce period, got %v", states)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			if states := r.states(); !slices.Equal(states, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, states)
+			}
+		})
+	}
+}
+
+func TestDebouncerHosts(t *testing.T) {
+	r := &recorder{}
+	d := NewDebouncer(r, 10*time.Millisecond)
+	d.Notify(Event{Host: "foo.example.com", Previous: "up", State: "down"})
+	d.Notify(Event{Host: "bar.example.com", Previous: "down", State: "up"})
+
+	time.Sleep(50 * time.Millisecond)
+	if states := r.states(); len(states) != 2 {
+		t.Errorf("expected a notification for each host, got %v", states)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	first, second := &recorder{}, &recorder{}
+	Multi{first, second}.Notify(Event{Previous: "up", State: "down"})
+	if len(first.events) != 1 || len(second.events) != 1 {
+		t.Errorf("expected every notifier to be notified")
+	}
+}
+
+func TestDebouncerServicesWithoutHost(t *testing.T) {
+	r := &recorder{}
+	d := NewDebouncer(r, 10*time.Millisecond)
+	d.Notify(Event{Service: "foo", Previous: "up", State: "down"})
+	d.Notify(Event{Service: "bar", Previous: "down", State: "up"})
+
+	time.Sleep(50 * time.Millisecond)
+	states := r.states()
+	slices.Sort(states)
+	if expected := []string{"down->up", "up->down"}; !slices.Equal(states, expected) {
+		t.Errorf("expected %v, got %v", expected, states)
+	}
+}
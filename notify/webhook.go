@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+var (
+	errMissingURL      = fmt.Errorf("webhook requires a url")
+	errInvalidTemplate = fmt.Errorf("invalid webhook body template")
+	errWebhookStatus   = fmt.Errorf("unexpected webhook response status")
+)
+
+const (
+	defaultWebhookMethod   = http.MethodPost
+	defaultWebhookRetries  = 3
+	defaultWebhookBackoff  = time.Second
+	defaultWebhookTimeout  = 10 * time.Second
+	defaultWebhookDebounce = 30 * time.Second
+)
+
+// Info describes a webhook notifier.
+type Info struct {
+	URL    string `yaml:"url"`
+	Method string `yaml:"method"`
+	// Headers are sent with every notification.
+	Headers map[string]string `yaml:"headers"`
+	// Body is a text/template for the request body, executed with the Event.
+	// The json function encodes a value as JSON. Defaults to the event encoded as JSON.
+	Body string `yaml:"body"`
+	// Retries is the number of times a failed notification is retried. A negative number disables retries.
+	Retries int `yaml:"retries"`
+	// Backoff is the delay before the first retry, which is doubled on every retry.
+	Backoff time.Duration `yaml:"backoff"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Debounce is how long a service's state must be stable before it is notified.
+	// A negative debounce notifies every change immediately.
+	Debounce time.Duration `yaml:"debounce"`
+}
+
+// Webhook sends notifications as HTTP requests.
+type Webhook struct {
+	Info
+	body   *template.Template
+	client *http.Client
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewWebhook creates a new Webhook.
+func NewWebhook(info Info) (*Webhook, error) {
+	if info.URL == "" {
+		return nil, errMissingURL
+	}
+	if info.Method == "" {
+		info.Method = defaultWebhookMethod
+	}
+	if info.Retries == 0 {
+		info.Retries = defaultWebhookRetries
+	}
+	if info.Backoff == 0 {
+		info.Backoff = defaultWebhookBackoff
+	}
+	if info.Timeout == 0 {
+		info.Timeout = defaultWebhookTimeout
+	}
+	if info.Debounce == 0 {
+		info.Debounce = defaultWebhookDebounce
+	}
+	w := &Webhook{Info: info, client: &http.Client{Timeout: info.Timeout}}
+	if info.Body != "" {
+		body, err := template.New("body").Funcs(templateFuncs).Parse(info.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidTemplate, err)
+		}
+		w.body = body
+	}
+	return w, nil
+}
+
+// New creates a notifier from the info, which is a webhook that is debounced.
+func New(info Info) (Notifier, error) {
+	w, err := NewWebhook(info)
+	if err != nil {
+		return nil, err
+	}
+	if w.Debounce < 0 {
+		return w, nil
+	}
+	return NewDebouncer(w, w.Debounce), nil
+}
+
+// Notify sends the event in the background, retrying with backoff if it fails.
+func (w *Webhook) Notify(event Event) {
+	go w.send(event)
+}
+
+func (w *Webhook) send(event Event) {
+	logger := slog.Default().With(
+		slog.String("host", event.Host),
+		slog.String("state", event.State),
+		slog.String("webhook", w.URL))
+
+	body, err := w.render(event)
+	if err != nil {
+		logger.Error("Error while rendering notification", slog.Any("error", err))
+		return
+	}
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			logger.Debug("Sent notification")
+			return
+		}
+		if attempt >= max(w.Retries, 0) {
+			logger.Error("Error while sending notification", slog.Any("error", err), slog.Int("attempts", attempt+1))
+			return
+		}
+		logger.Warn("Retrying notification", slog.Any("error", err), slog.Duration("backoff", backoff))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) render(event Event) ([]byte, error) {
+	if w.body == nil {
+		return json.Marshal(event)
+	}
+	var buf bytes.Buffer
+	if err := w.body.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Webhook) post(body []byte) error {
+	req, err := http.NewRequest(w.Method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.Headers {
+		req.Header.Set(key, value)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: got %d", errWebhookStatus, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewWebhookError(t *testing.T) {
+	tests := map[string]struct {
+		info        Info
+		expectedErr error
+	}{
+		"missing url":      {info: Info{}, expectedErr: errMissingURL},
+		"invalid template": {info: Info{URL: "http://example.com", Body: "{{"}, expectedErr: errInvalidTemplate},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(test.info); !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestNewDebounce(t *testing.T) {
+	debounced, err := New(Info{URL: "http://example.com"})
+	if _, ok := debounced.(*Debouncer); err != nil || !ok {
+		t.Errorf("expected debounced webhook, got %T (error %v)", debounced, err)
+	}
+	immediate, err := New(Info{URL: "http://example.com", Debounce: -1})
+	if _, ok := immediate.(*Webhook); err != nil || !ok {
+		t.Errorf("expected webhook, got %T (error %v)", immediate, err)
+	}
+}
+
+func TestWebhookRender(t *testing.T) {
+	event := Event{
+		Host:     "example.com",
+		Service:  "foo",
+		State:    "down",
+		Previous: "up",
+		Error:    `unexpected status: got 503`,
+		Time:     time.Unix(0, 0).UTC(),
+	}
+	tests := map[string]struct {
+		body     string
+		expected string
+	}{
+		"default": {
+			expected: `{"host":"example.com","service":"foo","state":"down","previous":"up","endpoint":"",` +
+				`"error":"unexpected status: got 503","time":"1970-01-01T00:00:00Z"}`,
+		},
+		"template": {
+			body:     `{"text": {{json (printf "%s is %s: %s" .Host .State .Error)}}}`,
+			expected: `{"text": "example.com is down: unexpected status: got 503"}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w, err := NewWebhook(Info{URL: "http://example.com", Body: test.body})
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			body, err := w.render(event)
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			if string(body) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, body)
+			}
+		})
+	}
+}
+
+func TestWebhookSendRetries(t *testing.T) {
+	requests := make(chan *http.Request, 3)
+	bodies := make(chan []byte, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		if len(requests) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	w, err := NewWebhook(Info{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Backoff: time.Millisecond,
+		Retries: 2,
+	})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	w.send(Event{Host: "example.com", State: "down"})
+
+	if len(requests) != 2 {
+		t.Fatalf("expected %d requests, got %d", 2, len(requests))
+	}
+	r, body := <-requests, <-bodies
+	if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" ||
+		r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected webhook request %+v", r)
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil || event.Host != "example.com" {
+		t.Errorf("unexpected webhook body %s (error %v)", body, err)
+	}
+}
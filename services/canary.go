@@ -0,0 +1,290 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCanaryInterval        = 10 * time.Minute
+	defaultCanaryMaxErrorRate    = 0.05
+	defaultCanaryMaxLatencyRatio = 1.5
+	defaultCanaryMinRequests     = 20
+)
+
+// defaultCanarySteps are the canary traffic shares of a rollout that does not specify its own.
+var defaultCanarySteps = []float64{0.05, 0.25, 0.5, 1}
+
+var errNoCanary = fmt.Errorf("load balancer has no canary")
+
+// Canary configures an automated canary rollout for a LoadBalancer.
+// The canary service's share of traffic is increased step by step on a schedule,
+// while the other services of the load balancer are stable and receive the remaining traffic.
+// If the canary performs worse than the stable services, its share is dropped to zero.
+type Canary struct {
+	// Service is the name of the canary service.
+	Service string
+	// Steps are the canary's traffic shares between 0 and 1, in increasing order.
+	// The rollout is complete once the last step has lasted for an interval.
+	Steps []float64
+	// Interval is how long each step lasts.
+	Interval time.Duration
+	// MaxErrorRate is how much higher the canary's rate of 5xx responses and connection errors
+	// may be than that of the stable services.
+	MaxErrorRate float64
+	// MaxLatencyRatio is how many times higher the canary's average latency may be
+	// than that of the stable services.
+	MaxLatencyRatio float64
+	// MinRequests is the number of requests the canary must have handled in a step before it is judged.
+	MinRequests int
+}
+
+func (c *Canary) setDefaults() {
+	if len(c.Steps) == 0 {
+		c.Steps = defaultCanarySteps
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultCanaryInterval
+	}
+	if c.MaxErrorRate <= 0 {
+		c.MaxErrorRate = defaultCanaryMaxErrorRate
+	}
+	if c.MaxLatencyRatio <= 0 {
+		c.MaxLatencyRatio = defaultCanaryMaxLatencyRatio
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaultCanaryMinRequests
+	}
+}
+
+// canaryStats accumulates the outcomes of proxied requests during a step.
+type canaryStats struct {
+	requests int
+	errors   int
+	latency  time.Duration
+}
+
+func (s *canaryStats) add(failed bool, latency time.Duration) {
+	s.requests++
+	if failed {
+		s.errors++
+	}
+	s.latency += latency
+}
+
+func (s canaryStats) errorRate() float64 {
+	return float64(s.errors) / float64(s.requests)
+}
+
+func (s canaryStats) meanLatency() time.Duration {
+	return s.latency / time.Duration(s.requests)
+}
+
+// rolloutState is the progress of a canary rollout.
+// It outlives the load balancer it was created for so that config reloads do not restart the rollout.
+type rolloutState struct {
+	host   string
+	canary string
+	steps  []float64
+
+	mu          sync.Mutex
+	step        int
+	stepStarted time.Time
+	rolledBack  bool
+	complete    bool
+	canaryStats canaryStats
+	stableStats canaryStats
+	// credit accumulates the canary's share of requests.
+	credit float64
+}
+
+// LogValue returns a slog.Value describing the progress of the rollout.
+// The caller must hold the lock.
+func (s *rolloutState) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("host", s.host),
+		slog.String("canary", s.canary),
+		slog.Int("step", s.step+1),
+		slog.Bool("rolledBack", s.rolledBack),
+		slog.Bool("complete", s.complete))
+}
+
+// rollouts holds the state of canary rollouts by host, keeping it across config reloads.
+var rollouts = struct {
+	mu     sync.Mutex
+	states map[string]*rolloutState
+}{states: make(map[string]*rolloutState)}
+
+// rollout selects between a canary and the stable services of a load balancer.
+type rollout struct {
+	Canary
+	// stable selects among the stable services.
+	stable Strategy
+	state  *rolloutState
+	now    func() time.Time
+}
+
+// newRollout creates a rollout for the load balancer of a host, resuming a previous rollout of
+// the same canary with the same steps if there is one.
+func newRollout(host string, stable Strategy, canary Canary) *rollout {
+	canary.setDefaults()
+	r := &rollout{Canary: canary, stable: stable, now: time.Now}
+
+	rollouts.mu.Lock()
+	defer rollouts.mu.Unlock()
+	state, ok := rollouts.states[host]
+	if ok && state.canary == canary.Service && slices.Equal(state.steps, canary.Steps) {
+		r.state = state
+		state.mu.Lock()
+		slog.Info("Resuming canary rollout", slog.Any("rollout", state), slog.Float64("share", r.share()))
+		state.mu.Unlock()
+	} else {
+		state = &rolloutState{host: host, canary: canary.Service, steps: canary.Steps, stepStarted: r.now()}
+		rollouts.states[host] = state
+		r.state = state
+		slog.Info("Starting canary rollout", slog.Any("rollout", state), slog.Float64("share", canary.Steps[0]))
+	}
+	return r
+}
+
+// pruneRollouts forgets the rollouts of the hosts whose load balancer no longer has that rollout,
+// so that adding the canary back later starts a new rollout.
+func pruneRollouts(services map[string]*Service) {
+	rollouts.mu.Lock()
+	defer rollouts.mu.Unlock()
+	for host, state := range rollouts.states {
+		var lb *LoadBalancer
+		if service, ok := services[host]; ok {
+			lb, _ = service.Router.(*LoadBalancer)
+		}
+		if lb == nil || lb.rollout == nil || lb.rollout.state != state {
+			delete(rollouts.states, host)
+		}
+	}
+}
+
+// RestartCanary restarts the canary rollout of the load balancer from its first step,
+// e.g. to roll out a new version of the canary after a rollback or a complete rollout.
+func (l *LoadBalancer) RestartCanary() error {
+	if l.rollout == nil {
+		return fmt.Errorf("%w: %s", errNoCanary, l.host)
+	}
+	s := l.rollout.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.step, s.stepStarted = 0, l.rollout.now()
+	s.rolledBack, s.complete = false, false
+	s.canaryStats, s.stableStats = canaryStats{}, canaryStats{}
+	s.credit = 0
+	slog.Info("Restarting canary rollout", slog.Any("rollout", s), slog.Float64("share", l.rollout.share()))
+	return nil
+}
+
+// share returns the canary's current share of traffic. The caller must hold the state's lock.
+func (r *rollout) share() float64 {
+	if r.state.rolledBack {
+		return 0
+	}
+	return r.Steps[r.state.step]
+}
+
+// advance moves the rollout to the next step once the current step has lasted long enough.
+// The caller must hold the state's lock.
+func (r *rollout) advance() {
+	s := r.state
+	if s.rolledBack || s.complete {
+		return
+	}
+	now := r.now()
+	if now.Sub(s.stepStarted) < r.Interval {
+		return
+	}
+	if s.step == len(r.Steps)-1 {
+		s.complete = true
+		slog.Info("Canary rollout complete", slog.Any("rollout", s))
+		return
+	}
+	s.step++
+	s.stepStarted = now
+	s.canaryStats, s.stableStats = canaryStats{}, canaryStats{}
+	slog.Info("Advancing canary rollout", slog.Any("rollout", s), slog.Float64("share", r.share()))
+}
+
+// judge rolls the canary back if it performs worse than the stable services.
+// The caller must hold the state's lock.
+func (r *rollout) judge() {
+	s := r.state
+	if s.rolledBack || s.complete || s.canaryStats.requests < r.MinRequests || s.stableStats.requests == 0 {
+		return
+	}
+	canaryRate, stableRate := s.canaryStats.errorRate(), s.stableStats.errorRate()
+	canaryLatency, stableLatency := s.canaryStats.meanLatency(), s.stableStats.meanLatency()
+	if canaryRate-stableRate <= r.MaxErrorRate && float64(canaryLatency) <= float64(stableLatency)*r.MaxLatencyRatio {
+		return
+	}
+	s.rolledBack = true
+	slog.Warn("Rolling back canary",
+		slog.Any("rollout", s),
+		slog.Float64("canaryErrorRate", canaryRate),
+		slog.Float64("stableErrorRate", stableRate),
+		slog.Duration("canaryLatency", canaryLatency),
+		slog.Duration("stableLatency", stableLatency))
+}
+
+// admits returns whether the named service may receive requests.
+// A canary that has been rolled back does not receive any requests.
+func (r *rollout) admits(name string) bool {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	return name != r.Service || !r.state.rolledBack
+}
+
+// Select returns the index of the canary for its share of requests,
+// and otherwise the index of a stable service selected by the stable strategy.
+// If no stable service is available, the canary is selected unless it has been rolled back.
+func (r *rollout) Select(services []*Service, req *http.Request) (int, error) {
+	canary := slices.IndexFunc(services, func(s *Service) bool { return s.Name == r.Service })
+	if canary < 0 {
+		return r.stable.Select(services, req)
+	}
+
+	r.state.mu.Lock()
+	r.advance()
+	share := r.share()
+	useCanary := false
+	if available(services[canary]) {
+		r.state.credit += share
+		if r.state.credit >= 1 {
+			r.state.credit--
+			useCanary = true
+		}
+	}
+	r.state.mu.Unlock()
+	if useCanary {
+		return canary, nil
+	}
+
+	stable := slices.Clone(services)
+	stable[canary] = unavailableService
+	next, err := r.stable.Select(stable, req)
+	if err != nil && share > 0 && available(services[canary]) {
+		return canary, nil
+	}
+	return next, err
+}
+
+// observe records the outcome of a proxied attempt and rolls the canary back if necessary.
+func (r *rollout) observe(service *Service, failed bool, latency time.Duration) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+	if service.Name == r.Service {
+		r.state.canaryStats.add(failed, latency)
+	} else {
+		r.state.stableStats.add(failed, latency)
+	}
+	r.judge()
+}
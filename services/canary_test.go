@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func canaryPool() []*Service {
+	return []*Service{
+		{Name: "stable", Health: health.Always(true)},
+		{Name: "canary", Health: health.Always(true)},
+	}
+}
+
+func TestRolloutAdvance(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newRollout("advance.example.com", &RoundRobin{}, Canary{
+		Service:  "canary",
+		Steps:    []float64{0.25, 0.5, 1},
+		Interval: time.Minute,
+	})
+	r.now = func() time.Time { return now }
+	r.state.stepStarted = now
+
+	pool := canaryPool()
+	tests := []struct {
+		elapsed  time.Duration
+		expected int
+	}{
+		{elapsed: 0, expected: 2},
+		{elapsed: time.Minute, expected: 4},
+		{elapsed: 2 * time.Minute, expected: 8},
+	}
+	for _, test := range tests {
+		now = time.Unix(0, 0).Add(test.elapsed)
+		canary := 0
+		for i := 0; i < 8; i++ {
+			next, err := r.Select(pool, nil)
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			if next == 1 {
+				canary++
+			}
+		}
+		if canary != test.expected {
+			t.Errorf("expected %d of 8 requests to canary after %s, got %d", test.expected, test.elapsed, canary)
+		}
+	}
+	if r.state.complete {
+		t.Errorf("expected rollout to not be complete before the last step has lasted for an interval")
+	}
+	now = now.Add(time.Minute)
+	if _, err := r.Select(pool, nil); err != nil || !r.state.complete {
+		t.Errorf("expected rollout to be complete, got error %v", err)
+	}
+}
+
+func TestRolloutRollback(t *testing.T) {
+	tests := map[string]struct {
+		canaryFailed  bool
+		canaryLatency time.Duration
+		expected      bool
+	}{
+		"healthy canary": {canaryLatency: 10 * time.Millisecond, expected: false},
+		"failing canary": {canaryFailed: true, canaryLatency: 10 * time.Millisecond, expected: true},
+		"slow canary":    {canaryLatency: time.Second, expected: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := newRollout("rollback-"+name, &RoundRobin{}, Canary{Service: "canary", MinRequests: 3})
+			pool := canaryPool()
+			r.observe(pool[0], false, 10*time.Millisecond)
+			for i := 0; i < 3; i++ {
+				r.observe(pool[1], test.canaryFailed, test.canaryLatency)
+			}
+
+			if r.state.rolledBack != test.expected {
+				t.Fatalf("expected rolled back %v, got %v", test.expected, r.state.rolledBack)
+			}
+			if r.admits("canary") == test.expected {
+				t.Errorf("expected canary to be admitted: %v", !test.expected)
+			}
+			if !test.expected {
+				return
+			}
+			for i := 0; i < 100; i++ {
+				if next, _ := r.Select(pool, nil); next == 1 {
+					t.Fatalf("expected rolled back canary to not be selected")
+				}
+			}
+		})
+	}
+}
+
+func TestRolloutRolledBackWithoutStable(t *testing.T) {
+	r := newRollout("unavailable.example.com", &RoundRobin{}, Canary{Service: "canary"})
+	pool := []*Service{
+		{Name: "stable", Health: health.Always(false)},
+		{Name: "canary", Health: health.Always(true)},
+	}
+	if next, err := r.Select(pool, nil); err != nil || next != 1 {
+		t.Errorf("expected canary to be selected without stable services, got %d (error %v)", next, err)
+	}
+
+	r.state.rolledBack = true
+	if _, err := r.Select(pool, nil); err == nil {
+		t.Errorf("expected no available service")
+	}
+}
+
+func TestRolloutResume(t *testing.T) {
+	host := "resume.example.com"
+	first := newRollout(host, &RoundRobin{}, Canary{Service: "canary", Steps: []float64{0.1, 0.5, 1}})
+	first.state.step = 2
+
+	reloaded := newRollout(host, &RoundRobin{}, Canary{Service: "canary", Steps: []float64{0.1, 0.5, 1}})
+	if reloaded.state != first.state {
+		t.Fatalf("expected rollout state to be kept across reloads")
+	}
+
+	newSteps := newRollout(host, &RoundRobin{}, Canary{Service: "canary", Steps: []float64{0.1, 0.5}})
+	if newSteps.state == first.state || newSteps.state.step != 0 {
+		t.Errorf("expected new steps to start a new rollout")
+	}
+
+	replaced := newRollout(host, &RoundRobin{}, Canary{Service: "other"})
+	if replaced.state == first.state || replaced.state.step != 0 {
+		t.Errorf("expected a new canary to start a new rollout")
+	}
+}
+
+func TestLoadBalancerCanaryRollback(t *testing.T) {
+	lb := NewLoadBalancer("canary.example.com", &RoundRobin{}, []*Service{
+		{Name: "stable", Health: health.Always(true), Router: NewRedirect(statusServerURL(t, http.StatusOK, 0))},
+		{
+			Name:   "canary",
+			Health: health.Always(true),
+			Router: NewRedirect(statusServerURL(t, http.StatusInternalServerError, 0)),
+		},
+	}, LoadBalancerOptions{Canary: &Canary{Service: "canary", Steps: []float64{0.5}, MinRequests: 2}})
+	services := map[string]*Service{"canary.example.com": {Router: lb}}
+
+	var codes []int
+	for i := 0; i < 8; i++ {
+		w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://canary.example.com", nil)
+		Handler(services).ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+
+	failures := 0
+	for _, code := range codes {
+		if code == http.StatusInternalServerError {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Errorf("expected canary to be rolled back after 2 failures, got %v", codes)
+	}
+}
+
+func TestRegistryReplacePrunesRollouts(t *testing.T) {
+	host := "prune.example.com"
+	canary := &Canary{Service: "canary"}
+	withCanary := func() map[string]*Service {
+		lb := NewLoadBalancer(host, &RoundRobin{}, canaryPool(), LoadBalancerOptions{Canary: canary})
+		return map[string]*Service{host: {Router: lb}}
+	}
+	first := withCanary()
+	registry := NewRegistry(first)
+	first[host].Router.(*LoadBalancer).rollout.state.rolledBack = true
+
+	reloaded := withCanary()
+	registry.Replace(reloaded)
+	if !reloaded[host].Router.(*LoadBalancer).rollout.state.rolledBack {
+		t.Fatalf("expected rollout state to be kept across reloads")
+	}
+
+	registry.Replace(map[string]*Service{host: {Router: NewLoadBalancer(host, &RoundRobin{}, canaryPool(),
+		LoadBalancerOptions{})}})
+	if readded := withCanary(); readded[host].Router.(*LoadBalancer).rollout.state.rolledBack {
+		t.Errorf("expected a canary added back after its removal to start a new rollout")
+	}
+}
+
+func TestLoadBalancerRestartCanary(t *testing.T) {
+	lb := NewLoadBalancer("restart.example.com", &RoundRobin{}, canaryPool(),
+		LoadBalancerOptions{Canary: &Canary{Service: "canary"}})
+	state := lb.rollout.state
+	state.step, state.rolledBack = 2, true
+
+	if err := lb.RestartCanary(); err != nil {
+		t.Fatal(err)
+	}
+	if state.step != 0 || state.rolledBack || !lb.rollout.admits("canary") {
+		t.Errorf("expected the rollout to restart from its first step, got %+v", state)
+	}
+
+	stable := NewLoadBalancer("stable.example.com", &RoundRobin{}, canaryPool(), LoadBalancerOptions{})
+	if err := stable.RestartCanary(); !errors.Is(err, errNoCanary) {
+		t.Errorf("expected error %v, got %v", errNoCanary, err)
+	}
+}
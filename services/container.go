@@ -33,8 +33,14 @@ func NewContainer(name string, network string, port uint16, docker dockerapi.Doc
 	}
 }
 
-// Route iterates through the list of containers and returns the remote of the matching container by name.
+// Route returns the remote of the container.
 func (c *Container) Route(_ http.ResponseWriter, _ *http.Request) (*url.URL, error) {
+	return c.Endpoint()
+}
+
+// Endpoint iterates through the list of containers and returns the remote of the matching container by name.
+// It is checked by health checks.
+func (c *Container) Endpoint() (*url.URL, error) {
 	containers, err := (*c.docker).ContainerList()
 	if err != nil {
 		return nil, err
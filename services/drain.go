@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+var errNotInPool = fmt.Errorf("service is not in the load balancer's pool")
+
+// drainSet holds the names of the drained services of a load balancer.
+type drainSet struct {
+	mu    sync.RWMutex
+	names map[string]bool
+}
+
+// drains holds the drained services by load balancer host, keeping them across config reloads.
+var drains = struct {
+	mu   sync.Mutex
+	sets map[string]*drainSet
+}{sets: make(map[string]*drainSet)}
+
+// drainSetOf returns the drained services of the load balancer of a host.
+func drainSetOf(host string) *drainSet {
+	drains.mu.Lock()
+	defer drains.mu.Unlock()
+	set, ok := drains.sets[host]
+	if !ok {
+		set = &drainSet{names: make(map[string]bool)}
+		drains.sets[host] = set
+	}
+	return set
+}
+
+// Drain stops routing new requests to the named service, e.g. before it is taken down for maintenance.
+// Requests that are already being proxied are unaffected, and sessions persisted on the service are moved.
+// The service stays drained across config reloads until it is enabled.
+func (l *LoadBalancer) Drain(name string) error {
+	return l.setDrained(name, true)
+}
+
+// Enable resumes routing requests to a drained service.
+func (l *LoadBalancer) Enable(name string) error {
+	return l.setDrained(name, false)
+}
+
+func (l *LoadBalancer) setDrained(name string, drained bool) error {
+	if l.serviceByName(name) == nil {
+		return fmt.Errorf("%w: %s", errNotInPool, name)
+	}
+	l.drained.mu.Lock()
+	defer l.drained.mu.Unlock()
+	if drained {
+		l.drained.names[name] = true
+		slog.Info("Draining service", slog.String("host", l.host), slog.String("service", name))
+	} else {
+		delete(l.drained.names, name)
+		slog.Info("Enabling service", slog.String("host", l.host), slog.String("service", name))
+	}
+	return nil
+}
+
+// Drained returns whether the named service is drained.
+func (l *LoadBalancer) Drained(name string) bool {
+	l.drained.mu.RLock()
+	defer l.drained.mu.RUnlock()
+	return l.drained.names[name]
+}
+
+// Services returns the services in the pool as seen by the load balancer.
+func (l *LoadBalancer) Services() []*Service {
+	return slices.Clone(l.services)
+}
+
+// pool returns the services that strategies select from.
+// Drained services are replaced rather than removed so that strategies see the same indices.
+func (l *LoadBalancer) pool() []*Service {
+	l.drained.mu.RLock()
+	defer l.drained.mu.RUnlock()
+	if len(l.drained.names) == 0 {
+		return l.services
+	}
+	pool := slices.Clone(l.services)
+	for i, service := range pool {
+		if l.drained.names[service.Name] {
+			pool[i] = unavailableService
+		}
+	}
+	return pool
+}
+
+// drainable is the health checker of a service within a load balancer, which is down while the service is drained.
+type drainable struct {
+	health.Checker
+	lb   *LoadBalancer
+	name string
+}
+
+// Up returns whether the service is up and not drained.
+func (d drainable) Up() bool {
+	return !d.lb.Drained(d.name) && d.Checker.Up()
+}
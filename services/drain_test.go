@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func newDrainTestLoadBalancer(host string, options LoadBalancerOptions) *LoadBalancer {
+	return NewLoadBalancer(host, &Failover{}, []*Service{
+		{Name: "foo", Health: health.Always(true), Router: NewRedirect(url.URL{Scheme: "http", Host: "foo"})},
+		{Name: "bar", Health: health.Always(true), Router: NewRedirect(url.URL{Scheme: "http", Host: "bar"})},
+	}, options)
+}
+
+func TestLoadBalancerDrain(t *testing.T) {
+	lb := newDrainTestLoadBalancer("drain.example.com", LoadBalancerOptions{})
+	route := func() string {
+		r := httptest.NewRequest(http.MethodGet, "http://drain.example.com", nil)
+		remote, err := lb.Route(httptest.NewRecorder(), r)
+		if err != nil {
+			return err.Error()
+		}
+		return remote.Host
+	}
+
+	if err := lb.Drain("foo"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if actual := route(); actual != "bar" {
+		t.Errorf("expected drained service to be skipped, got %s", actual)
+	}
+	if !lb.Drained("foo") || lb.Members()[0].Up() {
+		t.Errorf("expected drained service to be down")
+	}
+
+	if err := lb.Drain("bar"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if actual := route(); actual != errNoAvailableService.Error() {
+		t.Errorf("expected %v, got %s", errNoAvailableService, actual)
+	}
+
+	if err := lb.Enable("foo"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if actual := route(); actual != "foo" {
+		t.Errorf("expected enabled service to be routed to, got %s", actual)
+	}
+
+	if err := lb.Drain("baz"); !errors.Is(err, errNotInPool) {
+		t.Errorf("expected %v, got %v", errNotInPool, err)
+	}
+}
+
+func TestLoadBalancerDrainSurvivesReload(t *testing.T) {
+	lb := newDrainTestLoadBalancer("reload.example.com", LoadBalancerOptions{})
+	if err := lb.Drain("foo"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	reloaded := newDrainTestLoadBalancer("reload.example.com", LoadBalancerOptions{})
+	if !reloaded.Drained("foo") {
+		t.Errorf("expected service to stay drained after reload")
+	}
+}
+
+func TestLoadBalancerDrainPersistent(t *testing.T) {
+	lb := newDrainTestLoadBalancer("persistent-drain.example.com", LoadBalancerOptions{Persistence: &Persistence{}})
+
+	w := httptest.NewRecorder()
+	remote, err := lb.Route(w, httptest.NewRequest(http.MethodGet, "http://persistent-drain.example.com", nil))
+	if err != nil || remote.Host != "foo" {
+		t.Fatalf("expected foo, got %v (%v)", remote, err)
+	}
+	cookies := w.Result().Cookies()
+
+	if err := lb.Drain("foo"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://persistent-drain.example.com", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	remote, err = lb.Route(httptest.NewRecorder(), r)
+	if err != nil || remote.Host != "bar" {
+		t.Errorf("expected session to move to bar, got %v (%v)", remote, err)
+	}
+}
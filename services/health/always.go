@@ -1,24 +1,31 @@
 package health
 
-import (
-	"net/http"
-	"net/url"
-)
-
 // Always is a health checker that always returns the same value.
 // It is used when no health check is specified.
 type Always bool
 
 // Launch does nothing.
-func (a Always) Launch(func(w http.ResponseWriter, r *http.Request) (*url.URL, error)) {}
+func (a Always) Launch(Target) {}
 
 // Up always returns true.
 func (a Always) Up() bool {
 	return bool(a)
 }
 
+// Stop does nothing.
+func (a Always) Stop() {}
+
 // Check always returns a nil channel.
 // Receiving from this channel will block forever.
 func (a Always) Check() <-chan Result {
 	return nil
 }
+
+// History returns no results, with the service always up or always down.
+func (a Always) History() History {
+	history := History{State: StateDown}
+	if a {
+		history = History{State: StateUp, Uptime: Uptime{Hour: 1, Day: 1, Week: 1}}
+	}
+	return history
+}
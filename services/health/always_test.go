@@ -1,33 +1,33 @@
 package health
 
 import (
-	"net/http"
-	"net/url"
 	"testing"
 )
 
 func TestAlwaysUp(t *testing.T) {
 	au := Always(true)
-	au.Launch(func(w http.ResponseWriter, r *http.Request) (*url.URL, error) {
-		return nil, nil
-	})
+	au.Launch(remoteFunc(nil, nil))
 	if au.Up() != true {
 		t.Errorf("expected always up to be healthy")
 	}
 	if au.Check() != nil {
 		t.Errorf("expected always up channel to be nil")
 	}
+	if h := au.History(); h.State != StateUp || h.Uptime.Week != 1 {
+		t.Errorf("expected always up history to be up, got %+v", h)
+	}
 }
 
 func TestAlwaysDown(t *testing.T) {
 	au := Always(false)
-	au.Launch(func(w http.ResponseWriter, r *http.Request) (*url.URL, error) {
-		return nil, nil
-	})
+	au.Launch(remoteFunc(nil, nil))
 	if au.Up() != false {
 		t.Errorf("expected always up to be unhealthy")
 	}
 	if au.Check() != nil {
 		t.Errorf("expected always up channel to be nil")
 	}
+	if h := au.History(); h.State != StateDown || h.Uptime.Week != 0 {
+		t.Errorf("expected always down history to be down, got %+v", h)
+	}
 }
@@ -0,0 +1,273 @@
+package health
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/plamorg/voltproxy/metrics"
+)
+
+// Health check types.
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+	TypeExec = "exec"
+)
+
+var (
+	errInvalidType = fmt.Errorf("invalid health check type, must be one of: http, tcp, exec")
+	errNoTarget    = fmt.Errorf("service has no endpoint to check")
+)
+
+// NewChecker creates a health checker of the type given in the info.
+// If no type is given, the service is checked over HTTP.
+func NewChecker(info Info) (Checker, error) {
+	switch info.Type {
+	case TypeHTTP, "":
+		h := New(info)
+		if h.err != nil {
+			return nil, h.err
+		}
+		return h, nil
+	case TypeTCP:
+		return NewTCP(info), nil
+	case TypeExec:
+		if len(info.Command) == 0 {
+			return nil, errMissingCommand
+		}
+		return NewExec(info), nil
+	default:
+		return nil, fmt.Errorf("%w: got %s", errInvalidType, info.Type)
+	}
+}
+
+// State is the health state of a service.
+type State string
+
+// Health states. A service is in the unknown state until enough checks have succeeded or failed.
+const (
+	StateUnknown State = "unknown"
+	StateUp      State = "up"
+	StateDown    State = "down"
+)
+
+// defaultJitterFraction is the fraction of the interval used as jitter if none is given.
+const defaultJitterFraction = 10
+
+// results stores the latest result of a health checker and publishes every result.
+// It decides the state of the service from the consecutive successes and failures of its checks.
+type results struct {
+	c        chan Result
+	interval time.Duration
+	jitter   time.Duration
+	rise     int
+	fall     int
+	graceEnd time.Time
+	now      func() time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	resMutex  sync.RWMutex
+	res       Result
+	state     State
+	successes int
+	failures  int
+	history   history
+}
+
+// newResults creates the results of a health checker described by the info, whose interval must be set.
+func newResults(info Info) *results {
+	jitter := info.Jitter
+	if jitter == 0 {
+		jitter = info.Interval / defaultJitterFraction
+	}
+	jitter = max(jitter, 0)
+	rise, fall := max(info.HealthyThreshold, 1), max(info.UnhealthyThreshold, 1)
+	grace := info.GracePeriod
+	if grace == 0 {
+		// By default, a service is up until its checks have had the time to reach a threshold.
+		grace = time.Duration(max(rise, fall))*(info.Interval+jitter) + info.Timeout
+	}
+	return &results{
+		c:        make(chan Result),
+		interval: info.Interval,
+		jitter:   jitter,
+		rise:     rise,
+		fall:     fall,
+		graceEnd: time.Now().Add(max(grace, 0)),
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		state:    StateUnknown,
+		history:  newHistory(info.HistorySize, time.Now()),
+	}
+}
+
+// recorder is implemented by the health checkers that record their results.
+type recorder interface {
+	recorded() *results
+}
+
+func (r *results) recorded() *results {
+	return r
+}
+
+// Inherit carries the state and history of a previous health checker over to the checker replacing it,
+// e.g. when the configuration is reloaded, so that the service does not start over in the unknown state.
+// It must be called before the new checker is launched, and does nothing for checkers that record no results.
+func Inherit(next, previous Checker) {
+	n, ok := next.(recorder)
+	if !ok {
+		return
+	}
+	p, ok := previous.(recorder)
+	if !ok || n.recorded() == p.recorded() {
+		return
+	}
+	n.recorded().inherit(p.recorded())
+}
+
+// inherit copies the state, consecutive results and history of previous.
+func (r *results) inherit(previous *results) {
+	previous.resMutex.RLock()
+	defer previous.resMutex.RUnlock()
+	r.resMutex.Lock()
+	defer r.resMutex.Unlock()
+	r.res, r.state = previous.res, previous.state
+	r.successes, r.failures = previous.successes, previous.failures
+	r.history.inherit(&previous.history)
+}
+
+// record records the result of a check, updating the consecutive successes or failures, the state
+// and the history.
+func (r *results) record(res Result) {
+	r.resMutex.Lock()
+	previous := r.state
+	if res.Up {
+		r.successes++
+		r.failures = 0
+	} else {
+		r.failures++
+		r.successes = 0
+	}
+	if r.successes >= r.rise {
+		r.state = StateUp
+	} else if r.failures >= r.fall {
+		r.state = StateDown
+	}
+	res.State, res.Successes, res.Failures = r.state, r.successes, r.failures
+	res.Time = r.now()
+	r.res = res
+	r.history.add(res, previous)
+	r.resMutex.Unlock()
+	r.c <- res
+}
+
+// Up returns whether the service is up.
+// A service whose state is unknown is considered up during the grace period.
+func (r *results) Up() bool {
+	r.resMutex.RLock()
+	defer r.resMutex.RUnlock()
+	if r.state == StateUnknown {
+		return r.now().Before(r.graceEnd)
+	}
+	return r.state == StateUp
+}
+
+// currentState returns the state of the service.
+func (r *results) currentState() State {
+	r.resMutex.RLock()
+	defer r.resMutex.RUnlock()
+	return r.state
+}
+
+// Check returns a channel that will receive the health result on each check.
+func (r *results) Check() <-chan Result {
+	return r.c
+}
+
+// wait returns how long to wait until the next check, which is the interval plus a random jitter
+// so that the checks of many services are spread out.
+func (r *results) wait() time.Duration {
+	if r.jitter <= 0 {
+		return r.interval
+	}
+	return r.interval + time.Duration(rand.Int63n(int64(r.jitter)))
+}
+
+// initialDelay returns how long to wait until the first check, which is a random jitter
+// so that the checks of services started together, e.g. when the configuration is loaded, are spread out.
+func (r *results) initialDelay() time.Duration {
+	if r.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(r.jitter)))
+}
+
+// launch runs a check every interval and records the results until the checker is stopped.
+func (r *results) launch(check func() Result) {
+	r.poll(func() (Result, bool) { return check(), true })
+}
+
+// poll runs a check every interval and records the results it knows until the checker is stopped.
+// A check that does not know its result, e.g. because it depends on other checkers, is not recorded.
+func (r *results) poll(check func() (res Result, known bool)) {
+	defer close(r.c)
+	first := time.NewTimer(r.initialDelay())
+	select {
+	case <-first.C:
+	case <-r.stop:
+		first.Stop()
+		return
+	}
+	for {
+		next := time.NewTimer(r.wait())
+		if res, known := check(); known {
+			r.record(res)
+		}
+		select {
+		case <-next.C:
+		case <-r.stop:
+			next.Stop()
+			return
+		}
+	}
+}
+
+// Stop stops the periodic checks, after which the channel returned by Check is closed.
+func (r *results) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+var (
+	checksTotal = metrics.Default.NewCounter("voltproxy_health_checks_total",
+		"Number of health checks by type and result.", "type", "result")
+	checkDuration = metrics.Default.NewHistogram("voltproxy_health_check_duration_seconds",
+		"Time taken by the services to respond to health checks.", metrics.DefaultBuckets, "type")
+)
+
+// probeTarget probes the endpoint of a target, measuring how long the probe takes.
+// The type of the check labels its metrics.
+func probeTarget(target Target, checkType string, probe func(remote *url.URL) Result) (res Result) {
+	defer func() {
+		result := "failure"
+		if res.Up {
+			result = "success"
+		}
+		checksTotal.Inc(checkType, result)
+	}()
+	if target == nil {
+		return Result{Up: false, Endpoint: "", Err: errNoTarget}
+	}
+	remote, err := target.Endpoint()
+	if err != nil {
+		return Result{Up: false, Endpoint: "", Err: err}
+	}
+	start := time.Now()
+	res = probe(remote)
+	res.Latency = time.Since(start)
+	checkDuration.Observe(res.Latency.Seconds(), checkType)
+	return res
+}
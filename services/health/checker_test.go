@@ -0,0 +1,156 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestResultsThresholds(t *testing.T) {
+	r := newResults(Info{Interval: time.Second, HealthyThreshold: 2, UnhealthyThreshold: 3, GracePeriod: -1})
+	r.c = make(chan Result, 1)
+
+	tests := []struct {
+		up        bool
+		state     State
+		successes int
+		failures  int
+	}{
+		{up: false, state: StateUnknown, failures: 1},
+		{up: true, state: StateUnknown, successes: 1},
+		{up: true, state: StateUp, successes: 2},
+		{up: false, state: StateUp, failures: 1},
+		{up: false, state: StateUp, failures: 2},
+		{up: true, state: StateUp, successes: 1},
+		{up: false, state: StateUp, failures: 1},
+		{up: false, state: StateUp, failures: 2},
+		{up: false, state: StateDown, failures: 3},
+		{up: true, state: StateDown, successes: 1},
+		{up: true, state: StateUp, successes: 2},
+	}
+	for i, test := range tests {
+		r.record(Result{Up: test.up})
+		res := <-r.c
+		if res.State != test.state || res.Successes != test.successes || res.Failures != test.failures {
+			t.Errorf("check %d: expected %s with %d successes and %d failures, got %s with %d and %d",
+				i, test.state, test.successes, test.failures, res.State, res.Successes, res.Failures)
+		}
+		if r.Up() != (test.state == StateUp) {
+			t.Errorf("check %d: expected up %v, got %v", i, test.state == StateUp, r.Up())
+		}
+	}
+}
+
+func TestResultsGracePeriod(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newResults(Info{Interval: time.Second, GracePeriod: time.Minute})
+	r.graceEnd = now.Add(time.Minute)
+	r.now = func() time.Time { return now }
+
+	if !r.Up() {
+		t.Errorf("expected unknown service to be up during the grace period")
+	}
+	now = now.Add(time.Minute)
+	if r.Up() {
+		t.Errorf("expected unknown service to be down after the grace period")
+	}
+}
+
+func TestResultsDefaultGracePeriod(t *testing.T) {
+	start := time.Now()
+	r := newResults(Info{Interval: 10 * time.Second, Timeout: time.Second, Jitter: -1, UnhealthyThreshold: 3})
+	if !r.Up() {
+		t.Errorf("expected unknown service to be up before its first checks")
+	}
+	if expected := start.Add(31 * time.Second); r.graceEnd.Before(expected) {
+		t.Errorf("expected grace period to end after %s, got %s", expected, r.graceEnd)
+	}
+}
+
+func TestResultsInitialDelay(t *testing.T) {
+	r := newResults(Info{Interval: time.Minute, Jitter: time.Second})
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		delay := r.initialDelay()
+		if delay < 0 || delay >= time.Second {
+			t.Fatalf("expected initial delay within the jitter, got %s", delay)
+		}
+		delays[delay] = true
+	}
+	if len(delays) == 1 {
+		t.Errorf("expected random initial delays")
+	}
+	if delay := newResults(Info{Interval: time.Minute, Jitter: -1}).initialDelay(); delay != 0 {
+		t.Errorf("expected no initial delay without jitter, got %s", delay)
+	}
+}
+
+func TestResultsStop(t *testing.T) {
+	r := newResults(Info{Interval: time.Millisecond})
+	go r.launch(func() Result { return Result{Up: true} })
+
+	<-r.Check()
+	r.Stop()
+	r.Stop() // Stopping twice is harmless.
+	for range r.Check() {
+		// Results recorded before the checker stopped are still received until the channel is closed.
+	}
+}
+
+func TestProbeTarget(t *testing.T) {
+	remote := &url.URL{Scheme: "http", Host: "example.com"}
+	probe := func(r *url.URL) Result {
+		return Result{Up: true, Endpoint: r.String()}
+	}
+	targetErr := fmt.Errorf("no container")
+
+	tests := map[string]struct {
+		target      Target
+		expectedErr error
+	}{
+		"target":       {target: remoteFunc(remote, nil)},
+		"target error": {target: remoteFunc(nil, targetErr), expectedErr: targetErr},
+		"no target":    {target: nil, expectedErr: errNoTarget},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := probeTarget(test.target, TypeHTTP, probe)
+			if !errors.Is(res.Err, test.expectedErr) {
+				t.Fatalf("expected %v, got %v", test.expectedErr, res.Err)
+			}
+			if test.expectedErr == nil && (!res.Up || res.Endpoint != remote.String()) {
+				t.Errorf("expected %s to be probed, got %v", remote, res)
+			}
+		})
+	}
+}
+
+func TestResultsWait(t *testing.T) {
+	tests := map[string]struct {
+		info Info
+		min  time.Duration
+		max  time.Duration
+	}{
+		"default jitter": {info: Info{Interval: time.Second}, min: time.Second, max: 1100 * time.Millisecond},
+		"jitter": {
+			info: Info{Interval: time.Second, Jitter: time.Second},
+			min:  time.Second,
+			max:  2 * time.Second,
+		},
+		"no jitter": {info: Info{Interval: time.Second, Jitter: -1}, min: time.Second, max: time.Second},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := newResults(test.info)
+			for i := 0; i < 100; i++ {
+				if wait := r.wait(); wait < test.min || wait > test.max {
+					t.Fatalf("expected wait between %s and %s, got %s", test.min, test.max, wait)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var errMissingCommand = fmt.Errorf("exec health check requires a command")
+
+const (
+	// maxExecOutput is the maximum number of bytes of a command's output that are reported.
+	maxExecOutput = 1 << 10
+	// execWaitDelay is how long to wait for the output of a timed out command,
+	// e.g. when processes it started keep the output open.
+	execWaitDelay = time.Second
+)
+
+// Exec periodically runs a command to check the health of a service.
+// The service is up if the command exits with status 0 within the timeout.
+type Exec struct {
+	Info
+	*results
+}
+
+// NewExec creates a new Exec health checker.
+func NewExec(info Info) *Exec {
+	if info.Interval == 0 {
+		info.Interval = defaultHealthInterval
+	}
+	if info.Timeout == 0 {
+		info.Timeout = defaultHealthTimeout
+	}
+	return &Exec{
+		Info:    info,
+		results: newResults(info),
+	}
+}
+
+// Launch starts the periodic health check.
+// The command is given the service's remote in the VOLTPROXY_URL, VOLTPROXY_SCHEME, VOLTPROXY_HOST
+// and VOLTPROXY_PORT environment variables.
+func (e *Exec) Launch(target Target) {
+	e.launch(func() Result { return probeTarget(target, TypeExec, e.probe) })
+}
+
+func (e *Exec) probe(remote *url.URL) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, e.Command[0], e.Command[1:]...)
+	cmd.WaitDelay = execWaitDelay
+	cmd.Env = append(os.Environ(),
+		"VOLTPROXY_URL="+remote.String(),
+		"VOLTPROXY_SCHEME="+remote.Scheme,
+		"VOLTPROXY_HOST="+remote.Hostname(),
+		"VOLTPROXY_PORT="+remote.Port())
+	var output limitedBuffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	res := Result{Endpoint: strings.Join(e.Command, " ")}
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w after %s", ctx.Err(), e.Timeout)
+		}
+		res.Err = execError(err, output.Bytes())
+		return res
+	}
+	res.Up = true
+	return res
+}
+
+// limitedBuffer keeps the beginning of what is written to it, one byte past maxExecOutput so that
+// execError knows the output was truncated, and discards the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := maxExecOutput + 1 - b.Len(); n > 0 {
+		b.Buffer.Write(p[:min(n, len(p))])
+	}
+	return len(p), nil
+}
+
+// execError adds the truncated output of a failed command to its error.
+func execError(err error, output []byte) error {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return err
+	}
+	if len(output) > maxExecOutput {
+		output = append(output[:maxExecOutput:maxExecOutput], "..."...)
+	}
+	return fmt.Errorf("%w: %s", err, output)
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecProbe(t *testing.T) {
+	remote := &url.URL{Scheme: "http", Host: "example.com:8080", Path: "/app"}
+	tests := map[string]struct {
+		script      string
+		expectedUp  bool
+		expectedErr string
+	}{
+		"success": {script: "exit 0", expectedUp: true},
+		"failure": {script: "echo queue too deep >&2; exit 3", expectedErr: "exit status 3: queue too deep"},
+		"environment": {
+			script: `test "$VOLTPROXY_URL" = http://example.com:8080/app && test "$VOLTPROXY_SCHEME" = http &&
+				test "$VOLTPROXY_HOST" = example.com && test "$VOLTPROXY_PORT" = 8080`,
+			expectedUp: true,
+		},
+		"timeout": {script: "exec sleep 5", expectedErr: context.DeadlineExceeded.Error()},
+		"large output": {
+			script:      "yes | head -c 1000000; exit 1",
+			expectedErr: "exit status 1: y\ny\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := NewExec(Info{Command: []string{"sh", "-c", test.script}, Timeout: 100 * time.Millisecond})
+			res := e.probe(remote)
+			if res.Up != test.expectedUp {
+				t.Fatalf("expected up %v, got %v (error %v)", test.expectedUp, res.Up, res.Err)
+			}
+			if test.expectedErr != "" && (res.Err == nil || !strings.Contains(res.Err.Error(), test.expectedErr)) {
+				t.Errorf("expected error containing %q, got %v", test.expectedErr, res.Err)
+			}
+		})
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	var b limitedBuffer
+	chunk := []byte(strings.Repeat("a", maxExecOutput/2+1))
+	for i := 0; i < 10; i++ {
+		if n, err := b.Write(chunk); n != len(chunk) || err != nil {
+			t.Fatalf("expected %d bytes written, got %d (error %v)", len(chunk), n, err)
+		}
+	}
+	if b.Len() != maxExecOutput+1 {
+		t.Errorf("expected %d bytes kept, got %d", maxExecOutput+1, b.Len())
+	}
+}
+
+func TestExecError(t *testing.T) {
+	errExit := fmt.Errorf("exit status 1")
+	tests := map[string]struct {
+		output   string
+		expected string
+	}{
+		"no output": {output: " \n", expected: "exit status 1"},
+		"output":    {output: "failed\n", expected: "exit status 1: failed"},
+		"truncated": {
+			output:   strings.Repeat("a", maxExecOutput+1),
+			expected: "exit status 1: " + strings.Repeat("a", maxExecOutput) + "...",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := execError(errExit, []byte(test.output))
+			if !errors.Is(err, errExit) || err.Error() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, err)
+			}
+		})
+	}
+}
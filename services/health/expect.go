@@ -0,0 +1,105 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidStatus    = fmt.Errorf("invalid expected status, must be a code (200), range (200-299) or class (2xx)")
+	errInvalidBodyRegex = fmt.Errorf("invalid body regex")
+	errUnexpectedStatus = fmt.Errorf("unexpected status")
+	errUnexpectedBody   = fmt.Errorf("unexpected body")
+)
+
+// defaultStatuses are the expected statuses of a health check that does not specify its own.
+var defaultStatuses = []statusRange{{min: http.StatusOK, max: http.StatusBadRequest - 1}}
+
+// statusRange is an inclusive range of status codes.
+type statusRange struct {
+	min, max int
+}
+
+func (s statusRange) String() string {
+	if s.min == s.max {
+		return strconv.Itoa(s.min)
+	}
+	return fmt.Sprintf("%d-%d", s.min, s.max)
+}
+
+// parseStatusRange parses a status code (200), range (200-299) or class (2xx).
+func parseStatusRange(status string) (statusRange, error) {
+	if class, ok := strings.CutSuffix(strings.ToLower(status), "xx"); ok {
+		digit, err := strconv.Atoi(class)
+		if err != nil || digit < 1 || digit > 5 {
+			return statusRange{}, fmt.Errorf("%w: got %s", errInvalidStatus, status)
+		}
+		return statusRange{min: digit * 100, max: digit*100 + 99}, nil
+	}
+	low, high, isRange := strings.Cut(status, "-")
+	if !isRange {
+		high = low
+	}
+	minStatus, minErr := strconv.Atoi(strings.TrimSpace(low))
+	maxStatus, maxErr := strconv.Atoi(strings.TrimSpace(high))
+	if minErr != nil || maxErr != nil || minStatus > maxStatus {
+		return statusRange{}, fmt.Errorf("%w: got %s", errInvalidStatus, status)
+	}
+	return statusRange{min: minStatus, max: maxStatus}, nil
+}
+
+// expectation describes what the response to an HTTP health check must look like.
+type expectation struct {
+	statuses     []statusRange
+	bodyContains string
+	bodyRegex    *regexp.Regexp
+}
+
+// newExpectation creates the expectation described by the info.
+func newExpectation(info Info) (expectation, error) {
+	e := expectation{statuses: defaultStatuses, bodyContains: info.BodyContains}
+	if len(info.Status) > 0 {
+		e.statuses = make([]statusRange, 0, len(info.Status))
+		for _, status := range info.Status {
+			r, err := parseStatusRange(status)
+			if err != nil {
+				return e, err
+			}
+			e.statuses = append(e.statuses, r)
+		}
+	}
+	if info.BodyRegex != "" {
+		re, err := regexp.Compile(info.BodyRegex)
+		if err != nil {
+			return e, fmt.Errorf("%w: %w", errInvalidBodyRegex, err)
+		}
+		e.bodyRegex = re
+	}
+	return e, nil
+}
+
+// needsBody returns whether the response body must be read to verify the response.
+func (e expectation) needsBody() bool {
+	return e.bodyContains != "" || e.bodyRegex != nil
+}
+
+// verify returns a descriptive error if a response does not meet the expectation.
+func (e expectation) verify(status int, body []byte) error {
+	expected := false
+	for _, r := range e.statuses {
+		expected = expected || (status >= r.min && status <= r.max)
+	}
+	if !expected {
+		return fmt.Errorf("%w: got %d, expected %v", errUnexpectedStatus, status, e.statuses)
+	}
+	if e.bodyContains != "" && !strings.Contains(string(body), e.bodyContains) {
+		return fmt.Errorf("%w: does not contain %q", errUnexpectedBody, e.bodyContains)
+	}
+	if e.bodyRegex != nil && !e.bodyRegex.Match(body) {
+		return fmt.Errorf("%w: does not match %q", errUnexpectedBody, e.bodyRegex)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package health
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	tests := map[string]struct {
+		status      string
+		expected    statusRange
+		expectedErr error
+	}{
+		"code":          {status: "204", expected: statusRange{min: 204, max: 204}},
+		"range":         {status: "200-299", expected: statusRange{min: 200, max: 299}},
+		"class":         {status: "3xx", expected: statusRange{min: 300, max: 399}},
+		"upper class":   {status: "4XX", expected: statusRange{min: 400, max: 499}},
+		"invalid class": {status: "9xx", expectedErr: errInvalidStatus},
+		"reversed":      {status: "299-200", expectedErr: errInvalidStatus},
+		"invalid":       {status: "ok", expectedErr: errInvalidStatus},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual, err := parseStatusRange(test.status)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected %v, got %v", test.expectedErr, err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExpectationVerify(t *testing.T) {
+	tests := map[string]struct {
+		info        Info
+		status      int
+		body        string
+		expectedErr error
+	}{
+		"default":           {status: 302},
+		"default failure":   {status: 404, expectedErr: errUnexpectedStatus},
+		"expected status":   {info: Info{Status: []string{"200", "404"}}, status: 404},
+		"unexpected status": {info: Info{Status: []string{"2xx"}}, status: 302, expectedErr: errUnexpectedStatus},
+		"body contains":     {info: Info{BodyContains: "ok"}, status: 200, body: `{"status":"ok"}`},
+		"body missing": {
+			info:        Info{BodyContains: "ok"},
+			status:      200,
+			body:        `{"status":"degraded"}`,
+			expectedErr: errUnexpectedBody,
+		},
+		"body regex": {info: Info{BodyRegex: `"depth":\s*[0-9]\b`}, status: 200, body: `{"depth": 3}`},
+		"body no match": {
+			info:        Info{BodyRegex: `"depth":\s*[0-9]\b`},
+			status:      200,
+			body:        `{"depth": 300}`,
+			expectedErr: errUnexpectedBody,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := newExpectation(test.info)
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			if err := e.verify(test.status, []byte(test.body)); !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestNewExpectationError(t *testing.T) {
+	tests := map[string]struct {
+		info        Info
+		expectedErr error
+	}{
+		"invalid status": {info: Info{Status: []string{"abc"}}, expectedErr: errInvalidStatus},
+		"invalid regex":  {info: Info{BodyRegex: "("}, expectedErr: errInvalidBodyRegex},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newExpectation(test.info); !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected %v, got %v", test.expectedErr, err)
+			}
+			if _, err := NewChecker(test.info); !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
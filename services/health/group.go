@@ -0,0 +1,96 @@
+package health
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultGroupInterval is how often the health of a group is recorded if no interval is given.
+// Recording the health of a group is cheap, as its members are checked by their own checkers.
+const defaultGroupInterval = time.Second
+
+const percent = 100
+
+var errNotEnoughMembersUp = fmt.Errorf("not enough members are up")
+
+// Policy decides whether a group is up from how many of its members are up.
+// A group is up if at least MinUp of its members and at least MinUpPercent percent of its members are up.
+// The zero Policy requires any member to be up.
+type Policy struct {
+	MinUp        int
+	MinUpPercent float64
+}
+
+// check returns an error if too few members are up.
+func (p Policy) check(up, total int) error {
+	if up < max(p.MinUp, 1) {
+		return fmt.Errorf("%w: %d of %d up, need at least %d", errNotEnoughMembersUp, up, total, max(p.MinUp, 1))
+	}
+	if upPercent := float64(up) / float64(total) * percent; upPercent < p.MinUpPercent {
+		return fmt.Errorf("%w: %.0f%% of %d up, need at least %.0f%%",
+			errNotEnoughMembersUp, upPercent, total, p.MinUpPercent)
+	}
+	return nil
+}
+
+// Group is a health checker for a group of services, such as the members of a load balancer.
+// Its health is computed from the health of its members, which are checked by their own checkers.
+type Group struct {
+	Info
+	*results
+
+	policy  Policy
+	members []Checker
+}
+
+// NewGroup creates a health checker for a group of members whose health is decided by the policy.
+// Only the interval, thresholds, grace period, jitter and history size of the info are used.
+func NewGroup(info Info, policy Policy, members []Checker) *Group {
+	if info.Interval == 0 {
+		info.Interval = defaultGroupInterval
+	}
+	return &Group{
+		Info:    info,
+		results: newResults(info),
+		policy:  policy,
+		members: members,
+	}
+}
+
+// Launch starts periodically recording the health of the group.
+// The target is unused, as a group has no endpoint of its own.
+func (g *Group) Launch(Target) {
+	g.poll(g.probe)
+}
+
+// Up returns whether the group is up. Until its state is known, the group is up
+// if enough members are considered up, e.g. during their grace period.
+func (g *Group) Up() bool {
+	if g.currentState() == StateUnknown {
+		return g.evaluate().Up
+	}
+	return g.results.Up()
+}
+
+// probe evaluates the group once the state of every member is known,
+// so that the group stays unknown instead of going down while its members are being checked.
+func (g *Group) probe() (Result, bool) {
+	for _, member := range g.members {
+		if member.History().State == StateUnknown {
+			return Result{}, false
+		}
+	}
+	return g.evaluate(), true
+}
+
+// evaluate returns whether enough members are up according to the policy.
+func (g *Group) evaluate() Result {
+	up := 0
+	for _, member := range g.members {
+		if member.Up() {
+			up++
+		}
+	}
+	err := g.policy.check(up, len(g.members))
+	return Result{Up: err == nil, Err: err}
+}
@@ -0,0 +1,87 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGroupProbe(t *testing.T) {
+	tests := map[string]struct {
+		policy   Policy
+		members  []Checker
+		expected bool
+	}{
+		"all up":   {members: []Checker{Always(true), Always(true)}, expected: true},
+		"one up":   {members: []Checker{Always(false), Always(true)}, expected: true},
+		"all down": {members: []Checker{Always(false), Always(false)}, expected: false},
+		"empty":    {members: nil, expected: false},
+		"at least two up": {
+			policy:   Policy{MinUp: 2},
+			members:  []Checker{Always(true), Always(true), Always(false)},
+			expected: true,
+		},
+		"fewer than two up": {
+			policy:   Policy{MinUp: 2},
+			members:  []Checker{Always(true), Always(false), Always(false)},
+			expected: false,
+		},
+		"percentage up": {
+			policy:   Policy{MinUpPercent: 50},
+			members:  []Checker{Always(true), Always(false)},
+			expected: true,
+		},
+		"percentage down": {
+			policy:   Policy{MinUpPercent: 50},
+			members:  []Checker{Always(true), Always(false), Always(false)},
+			expected: false,
+		},
+		"both": {
+			policy:   Policy{MinUp: 2, MinUpPercent: 50},
+			members:  []Checker{Always(true), Always(true), Always(false), Always(false), Always(false)},
+			expected: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := NewGroup(Info{}, test.policy, test.members).evaluate()
+			if res.Up != test.expected {
+				t.Errorf("expected %v, got %v (error %v)", test.expected, res.Up, res.Err)
+			}
+			if !test.expected && !errors.Is(res.Err, errNotEnoughMembersUp) {
+				t.Errorf("expected %v, got %v", errNotEnoughMembersUp, res.Err)
+			}
+		})
+	}
+}
+
+func TestGroupLaunch(t *testing.T) {
+	group := NewGroup(Info{Interval: time.Millisecond}, Policy{}, []Checker{Always(false), Always(true)})
+	go group.Launch(nil)
+
+	res := <-group.Check()
+	if !res.Up || res.State != StateUp || !group.Up() {
+		t.Errorf("expected group to be up, got %v", res)
+	}
+}
+
+func TestGroupUnknownMembers(t *testing.T) {
+	unknown := NewTCP(Info{Interval: time.Hour})
+	group := NewGroup(Info{Interval: time.Millisecond, GracePeriod: -1}, Policy{MinUp: 2},
+		[]Checker{unknown, Always(true)})
+
+	if _, known := group.probe(); known {
+		t.Errorf("expected group to be unknown while a member is unknown")
+	}
+	if !group.Up() {
+		t.Errorf("expected group to be up while its unknown member is in its grace period")
+	}
+
+	unknown.c = make(chan Result, 1)
+	unknown.record(Result{Up: false})
+	res, known := group.probe()
+	if !known || res.Up {
+		t.Errorf("expected group to be down once its member is known to be down, got %v", res)
+	}
+}
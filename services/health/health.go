@@ -2,11 +2,14 @@
 package health
 
 import (
+	"crypto/tls"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,18 +22,74 @@ const (
 
 // Info describes a service Health capability.
 type Info struct {
+	// Type is the type of health check, http, tcp or exec. Defaults to http.
+	Type     string        `yaml:"type"`
 	Path     string        `yaml:"path"`
 	TLS      bool          `yaml:"tls"`
 	Interval time.Duration `yaml:"interval"`
 	Timeout  time.Duration `yaml:"timeout"`
 	Method   string        `yaml:"method"`
+	// Command is the command run by exec health checks, followed by its arguments.
+	Command []string `yaml:"command"`
+	// LoadHeader is the response header in which the service reports its load, if any.
+	LoadHeader string `yaml:"loadHeader"`
+
+	// Status are the expected response status codes (200), ranges (200-299) or classes (2xx).
+	// Defaults to 200-399.
+	Status []string `yaml:"status"`
+	// BodyContains is a substring that the response body must contain.
+	BodyContains string `yaml:"bodyContains"`
+	// BodyRegex is a regular expression that the response body must match.
+	BodyRegex string `yaml:"bodyRegex"`
+
+	// Headers are sent with the health check request.
+	Headers map[string]string `yaml:"headers"`
+	// Host overrides the Host header of the health check request, e.g. for name-based virtual hosts.
+	Host string `yaml:"host"`
+	// Body is sent as the body of the health check request.
+	Body string `yaml:"body"`
+	// FollowRedirects is whether redirects are followed. Defaults to true.
+	FollowRedirects *bool `yaml:"followRedirects"`
+	// InsecureSkipVerify disables verification of the service's TLS certificate.
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+
+	// HealthyThreshold is the number of consecutive successful checks after which a service is up.
+	// Defaults to 1.
+	HealthyThreshold int `yaml:"healthyThreshold"`
+	// UnhealthyThreshold is the number of consecutive failed checks after which a service is down.
+	// Defaults to 1.
+	UnhealthyThreshold int `yaml:"unhealthyThreshold"`
+	// GracePeriod is how long a service is considered up before its state is known. Defaults to the time
+	// its checks take to reach a threshold, and a negative grace period disables it.
+	GracePeriod time.Duration `yaml:"gracePeriod"`
+	// Jitter is the maximum random delay added to each interval. Defaults to a tenth of the interval,
+	// and a negative jitter disables it.
+	Jitter time.Duration `yaml:"jitter"`
+	// HistorySize is the number of recent results kept in the history. Defaults to 100.
+	HistorySize int `yaml:"historySize"`
 }
 
 // Result is the result of a health check.
 type Result struct {
+	// Up is whether the check succeeded.
 	Up       bool
 	Err      error
 	Endpoint string
+	// Time is when the check completed, and Latency is how long the service took to respond.
+	Time    time.Time
+	Latency time.Duration
+	// StatusCode is the status code of the response to an HTTP check, and 0 for other checks.
+	StatusCode int
+
+	// State is the state of the service after the check.
+	State State
+	// Successes and Failures are the number of consecutive successful or failed checks.
+	Successes int
+	Failures  int
+
+	// load is the load reported by the service, if hasLoad is set.
+	load    float64
+	hasLoad bool
 }
 
 // LogValue returns a slog.Value for the result, ensuring that the error is displayed properly.
@@ -38,24 +97,47 @@ func (h Result) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.Bool("up", h.Up),
 		slog.Any("error", h.Err),
-		slog.String("endpoint", h.Endpoint))
+		slog.String("endpoint", h.Endpoint),
+		slog.Duration("latency", h.Latency),
+		slog.Int("statusCode", h.StatusCode),
+		slog.String("state", string(h.State)),
+		slog.Int("successes", h.Successes),
+		slog.Int("failures", h.Failures))
+}
+
+// Target is something whose health can be checked, such as the service a router routes to.
+type Target interface {
+	// Endpoint returns the URL of the service to check.
+	Endpoint() (*url.URL, error)
+}
+
+// TargetFunc is an adapter to allow the use of ordinary functions as targets.
+type TargetFunc func() (*url.URL, error)
+
+// Endpoint calls f().
+func (f TargetFunc) Endpoint() (*url.URL, error) {
+	return f()
 }
 
 // Checker is the interface that wraps the basic methods for a health checker.
 type Checker interface {
-	Launch(remoteFunc func(w http.ResponseWriter, r *http.Request) (*url.URL, error))
+	Launch(target Target)
 	Up() bool
 	Check() <-chan Result
+	History() History
+	Stop()
 }
 
 // Health periodically checks the health of a service.
 type Health struct {
 	Info
 	http.Handler
+	*results
 
-	c        chan Result
-	resMutex sync.RWMutex
-	res      Result
+	client *http.Client
+	expect expectation
+	// err is the error in the info, which is reported by every health check.
+	err error
 }
 
 // New creates a new Health.
@@ -72,52 +154,72 @@ func New(info Info) *Health {
 	if info.Method == "" {
 		info.Method = defaultHealthMethod
 	}
+	expect, err := newExpectation(info)
 	return &Health{
-		Info:     info,
-		c:        make(chan Result),
-		resMutex: sync.RWMutex{},
-		res:      Result{},
+		Info:    info,
+		results: newResults(info),
+		client:  newClient(info),
+		expect:  expect,
+		err:     err,
 	}
 }
 
-// Launch starts the periodic health check.
-// A remoteFunc is used to get the service's remote URL in the case that the remote URL is dynamic.
-// This remote is then used to construct the health remote URL that will be used for the health check.
-func (h *Health) Launch(remoteFunc func(w http.ResponseWriter, r *http.Request) (*url.URL, error)) {
-	ticker := time.NewTicker(h.Interval)
-	for {
-		w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)
-		remote, err := remoteFunc(w, r)
-		if err != nil {
-			h.resMutex.Lock()
-			h.res = Result{Up: false, Endpoint: "", Err: err}
-			h.resMutex.Unlock()
-			h.c <- h.res
-			<-ticker.C
-			continue
+// newClient creates the HTTP client used for the health checks described by the info.
+func newClient(info Info) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Certificate verification is only skipped when configured.
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: info.InsecureSkipVerify} //nolint:gosec
+	client := &http.Client{Transport: transport, Timeout: info.Timeout}
+	if info.FollowRedirects != nil && !*info.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
 		}
+	}
+	return client
+}
 
-		healthRemote := constructHealthRemote(remote, h.Path, h.TLS)
-		status, err := h.requestStatus(healthRemote)
-		up := status >= http.StatusOK && status < http.StatusBadRequest
-		h.resMutex.Lock()
-		h.res = Result{Up: up, Endpoint: healthRemote.String(), Err: err}
-		h.resMutex.Unlock()
-		h.c <- h.res
-		<-ticker.C
+// Launch starts the periodic health check.
+// The target's endpoint is looked up on every check in the case that it is dynamic.
+// This endpoint is then used to construct the health remote URL that will be used for the health check.
+func (h *Health) Launch(target Target) {
+	h.launch(func() Result { return probeTarget(target, TypeHTTP, h.probe) })
+}
+
+func (h *Health) probe(remote *url.URL) Result {
+	healthRemote := constructHealthRemote(remote, h.Path, h.TLS)
+	res := Result{Endpoint: healthRemote.String(), Err: h.err}
+	if res.Err != nil {
+		return res
 	}
+	status, header, body, err := h.request(healthRemote)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.StatusCode = status
+	if h.LoadHeader != "" {
+		res.load, res.hasLoad = ParseLoad(header.Get(h.LoadHeader))
+	}
+	res.Err = h.expect.verify(status, body)
+	res.Up = res.Err == nil
+	return res
 }
 
-// Up returns whether the service is up.
-func (h *Health) Up() bool {
+// Load returns the load reported by the service in the last health check,
+// and whether it reported one.
+func (h *Health) Load() (float64, bool) {
 	h.resMutex.RLock()
 	defer h.resMutex.RUnlock()
-	return h.res.Up
+	return h.res.load, h.res.hasLoad
 }
 
-// Check returns a channel that will receive the health result on each check.
-func (h *Health) Check() <-chan Result {
-	return h.c
+// ParseLoad parses a load reported by a service, clamping it between 0 (idle) and 1 (fully loaded).
+func ParseLoad(value string) (float64, bool) {
+	load, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(load) {
+		return 0, false
+	}
+	return min(max(load, 0), 1), true
 }
 
 func constructHealthRemote(remote *url.URL, path string, tls bool) *url.URL {
@@ -131,21 +233,39 @@ func constructHealthRemote(remote *url.URL, path string, tls bool) *url.URL {
 	return &healthRemote
 }
 
-func (h *Health) requestStatus(healthRemote *url.URL) (int, error) {
-	req, err := http.NewRequest(h.Method, healthRemote.String(), nil)
+// maxHealthBodySize is the maximum number of bytes of a response body that are matched.
+const maxHealthBodySize = 64 << 10
+
+// request sends the health check request and returns the response's status, header and body.
+// The body is only read if it needs to be matched.
+func (h *Health) request(healthRemote *url.URL) (int, http.Header, []byte, error) {
+	var reqBody io.Reader
+	if h.Body != "" {
+		reqBody = strings.NewReader(h.Body)
+	}
+	req, err := http.NewRequest(h.Method, healthRemote.String(), reqBody)
 	if err != nil {
-		return 0, err
+		return 0, nil, nil, err
 	}
-
-	client := &http.Client{
-		Timeout: h.Timeout,
+	for key, value := range h.Headers {
+		req.Header.Set(key, value)
+	}
+	if h.Host != "" {
+		req.Host = h.Host
 	}
 
-	resp, err := client.Do(req)
+	resp, err := h.client.Do(req)
 	if err != nil {
-		return 0, err
+		return 0, nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	return resp.StatusCode, nil
+	var body []byte
+	if h.expect.needsBody() {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxHealthBodySize))
+		if err != nil {
+			return 0, nil, nil, err
+		}
+	}
+	return resp.StatusCode, resp.Header, body, nil
 }
@@ -1,7 +1,9 @@
 package health
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -24,8 +26,8 @@ func newMockServer(path string, sequence ...int) mockServer {
 	return mockServer{wg: &wg, path: path, healthSequence: sequence}
 }
 
-func remoteFunc(remote *url.URL, err error) func(http.ResponseWriter, *http.Request) (*url.URL, error) {
-	return func(http.ResponseWriter, *http.Request) (*url.URL, error) {
+func remoteFunc(remote *url.URL, err error) TargetFunc {
+	return func() (*url.URL, error) {
 		return remote, err
 	}
 }
@@ -148,7 +150,11 @@ func TestHealthLaunchFailedRemote(t *testing.T) {
 	go health.Launch(remoteFunc(nil, expectedErr))
 
 	res := <-health.c
-	expected := Result{Up: false, Endpoint: "", Err: expectedErr}
+	if res.Time.IsZero() {
+		t.Errorf("expected result time to be set")
+	}
+	res.Time = time.Time{}
+	expected := Result{Up: false, Endpoint: "", Err: expectedErr, State: StateDown, Failures: 1}
 	if !reflect.DeepEqual(res, expected) {
 		t.Errorf("expected %v, got %v", expected, res)
 	}
@@ -210,3 +216,125 @@ func TestHealthLaunch(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLoad(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected float64
+		ok       bool
+	}{
+		"valid":    {value: "0.73", expected: 0.73, ok: true},
+		"negative": {value: "-1", expected: 0, ok: true},
+		"overload": {value: "1.5", expected: 1, ok: true},
+		"empty":    {value: "", ok: false},
+		"invalid":  {value: "busy", ok: false},
+		"nan":      {value: "NaN", ok: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			load, ok := ParseLoad(test.value)
+			if load != test.expected || ok != test.ok {
+				t.Errorf("expected %v (%v), got %v (%v)", test.expected, test.ok, load, ok)
+			}
+		})
+	}
+}
+
+func TestHealthLaunchLoad(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Load", "0.25")
+	}))
+	defer server.Close()
+
+	remote, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("could not parse url %v", err)
+	}
+
+	health := New(Info{Interval: time.Millisecond, LoadHeader: "X-Backend-Load"})
+	if _, ok := health.Load(); ok {
+		t.Errorf("expected no load before the first health check")
+	}
+
+	go health.Launch(remoteFunc(remote, nil))
+	<-health.Check()
+
+	if load, ok := health.Load(); load != 0.25 || !ok {
+		t.Errorf("expected load %v, got %v (%v)", 0.25, load, ok)
+	}
+}
+
+func TestHealthRequest(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received, receivedBody = r, string(body)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/health", http.StatusFound)
+			return
+		}
+		w.Write([]byte("healthy"))
+	}))
+	defer server.Close()
+	remote, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("could not parse url %v", err)
+	}
+	noFollow := false
+
+	tests := map[string]struct {
+		info         Info
+		expectedUp   bool
+		expectedErr  error
+		checkRequest bool
+	}{
+		"unverified certificate": {
+			info: Info{Path: "/health"},
+		},
+		"request": {
+			info: Info{
+				Path:               "/health",
+				Method:             http.MethodPost,
+				Headers:            map[string]string{"Authorization": "Bearer token"},
+				Host:               "app.example.com",
+				Body:               "ping",
+				BodyContains:       "healthy",
+				InsecureSkipVerify: true,
+			},
+			expectedUp:   true,
+			checkRequest: true,
+		},
+		"follow redirects": {
+			info:       Info{Path: "/redirect", Status: []string{"200"}, InsecureSkipVerify: true},
+			expectedUp: true,
+		},
+		"do not follow redirects": {
+			info: Info{
+				Path:               "/redirect",
+				Status:             []string{"200"},
+				FollowRedirects:    &noFollow,
+				InsecureSkipVerify: true,
+			},
+			expectedErr: errUnexpectedStatus,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.info.TLS = true
+			res := New(test.info).probe(remote)
+			if res.Up != test.expectedUp {
+				t.Fatalf("expected up %v, got %v (error %v)", test.expectedUp, res.Up, res.Err)
+			}
+			if test.expectedErr != nil && !errors.Is(res.Err, test.expectedErr) {
+				t.Errorf("expected %v, got %v", test.expectedErr, res.Err)
+			}
+			if test.checkRequest && (received.Host != "app.example.com" ||
+				received.Header.Get("Authorization") != "Bearer token" || receivedBody != "ping") {
+				t.Errorf("unexpected health check request %+v with body %q", received, receivedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package health
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+)
+
+const (
+	// defaultHistorySize is the number of recent results kept if no history size is given.
+	defaultHistorySize = 100
+
+	// maxTransitions caps the number of state changes kept to compute uptime for services that flap quickly.
+	maxTransitions = 10000
+)
+
+// Uptime windows.
+const (
+	uptimeHour = time.Hour
+	uptimeDay  = 24 * time.Hour
+	uptimeWeek = 7 * uptimeDay
+)
+
+// History is the recent history of a health checker.
+type History struct {
+	// Results are the most recent results, oldest first.
+	Results []Result
+	// State is the current state of the service.
+	State State
+	// LastChange is when the state last changed, or the zero time if it never changed.
+	LastChange time.Time
+	// Uptime is the fraction of time that the service was up over rolling windows.
+	Uptime Uptime
+}
+
+// Uptime is the fraction of time, between 0 and 1, that a service was up over the last hour, day and week.
+// Time before the health checker started is not counted, and time in the unknown state counts as down.
+type Uptime struct {
+	Hour float64
+	Day  float64
+	Week float64
+}
+
+// LogValue returns a slog.Value with the uptime in each window.
+func (u Uptime) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Float64("hour", u.Hour),
+		slog.Float64("day", u.Day),
+		slog.Float64("week", u.Week))
+}
+
+// transition is a change of state.
+type transition struct {
+	time  time.Time
+	state State
+}
+
+// history keeps the recent results and state changes of a health checker.
+// It is guarded by the results' mutex.
+type history struct {
+	started time.Time
+	// ring holds the recent results, and next is the index at which the next result is stored.
+	ring        []Result
+	next        int
+	full        bool
+	transitions []transition
+}
+
+func newHistory(size int, started time.Time) history {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	return history{started: started, ring: make([]Result, size)}
+}
+
+// push stores a result in the ring, overwriting the oldest one once the ring is full.
+func (h *history) push(res Result) {
+	h.ring[h.next] = res
+	h.next = (h.next + 1) % len(h.ring)
+	h.full = h.full || h.next == 0
+}
+
+// add adds a result, and a transition if the state changed.
+func (h *history) add(res Result, previous State) {
+	h.push(res)
+
+	if res.State == previous {
+		return
+	}
+	h.transitions = append(h.transitions, transition{time: res.Time, state: res.State})
+	// Forget transitions that ended before the longest window, or that exceed the cap.
+	cutoff := res.Time.Add(-uptimeWeek)
+	drop := 0
+	for drop < len(h.transitions)-1 && !h.transitions[drop+1].time.After(cutoff) {
+		drop++
+	}
+	drop = max(drop, len(h.transitions)-maxTransitions)
+	h.transitions = h.transitions[drop:]
+}
+
+// inherit carries the results and state changes of a previous history over,
+// keeping as many of the most recent results as fit.
+func (h *history) inherit(previous *history) {
+	h.started = previous.started
+	for _, res := range previous.results() {
+		h.push(res)
+	}
+	h.transitions = slices.Clone(previous.transitions)
+}
+
+// results returns the recent results, oldest first.
+func (h *history) results() []Result {
+	if !h.full {
+		return append([]Result(nil), h.ring[:h.next]...)
+	}
+	return append(append([]Result(nil), h.ring[h.next:]...), h.ring[:h.next]...)
+}
+
+// lastChange returns when the state last changed.
+func (h *history) lastChange() time.Time {
+	if len(h.transitions) == 0 {
+		return time.Time{}
+	}
+	return h.transitions[len(h.transitions)-1].time
+}
+
+// uptime returns the fraction of the window ending now that the service was up.
+func (h *history) uptime(window time.Duration, now time.Time) float64 {
+	from := now.Add(-window)
+	if from.Before(h.started) {
+		from = h.started
+	}
+	total := now.Sub(from)
+	if total <= 0 {
+		return 0
+	}
+	var up time.Duration
+	for i, t := range h.transitions {
+		if t.state != StateUp {
+			continue
+		}
+		start, end := t.time, now
+		if i+1 < len(h.transitions) {
+			end = h.transitions[i+1].time
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(start) {
+			up += end.Sub(start)
+		}
+	}
+	return float64(up) / float64(total)
+}
+
+// History returns the recent results of the health checker along with its state and uptime.
+func (r *results) History() History {
+	r.resMutex.RLock()
+	defer r.resMutex.RUnlock()
+	now := r.now()
+	return History{
+		Results:    r.history.results(),
+		State:      r.state,
+		LastChange: r.history.lastChange(),
+		Uptime: Uptime{
+			Hour: r.history.uptime(uptimeHour, now),
+			Day:  r.history.uptime(uptimeDay, now),
+			Week: r.history.uptime(uptimeWeek, now),
+		},
+	}
+}
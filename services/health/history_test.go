@@ -0,0 +1,136 @@
+package health
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHistoryResults(t *testing.T) {
+	r := newResults(Info{Interval: time.Second, HistorySize: 3})
+	r.c = make(chan Result, 1)
+
+	for i := 1; i <= 5; i++ {
+		r.record(Result{Up: true, StatusCode: i})
+		<-r.c
+	}
+
+	results := r.History().Results
+	if len(results) != 3 {
+		t.Fatalf("expected %d results, got %d", 3, len(results))
+	}
+	for i, res := range results {
+		if expected := i + 3; res.StatusCode != expected {
+			t.Errorf("expected result %d to have status code %d, got %d", i, expected, res.StatusCode)
+		}
+	}
+}
+
+func TestInherit(t *testing.T) {
+	previous := NewTCP(Info{Interval: time.Second, HistorySize: 5, UnhealthyThreshold: 2})
+	previous.c = make(chan Result, 1)
+	for i := 1; i <= 4; i++ {
+		previous.record(Result{Up: i <= 2, StatusCode: i})
+		<-previous.c
+	}
+
+	next := NewTCP(Info{Interval: time.Second, HistorySize: 3, HealthyThreshold: 2, GracePeriod: -1})
+	Inherit(next, previous)
+	Inherit(next, Always(true)) // Checkers that record no results are ignored.
+
+	history := next.History()
+	if history.State != StateDown || next.Up() {
+		t.Errorf("expected inherited state %s, got %s", StateDown, history.State)
+	}
+	if history.LastChange != previous.History().LastChange {
+		t.Errorf("expected last change %s, got %s", previous.History().LastChange, history.LastChange)
+	}
+	if len(history.Results) != 3 || history.Results[0].StatusCode != 2 {
+		t.Errorf("expected the 3 most recent results, got %v", history.Results)
+	}
+
+	// The inherited service stays down until it reaches the healthy threshold.
+	next.c = make(chan Result, 1)
+	next.record(Result{Up: true})
+	if res := <-next.c; res.State != StateDown || res.Successes != 1 {
+		t.Errorf("expected state %s with 1 success, got %v", StateDown, res)
+	}
+}
+
+func TestHistoryUptime(t *testing.T) {
+	start := time.Unix(0, 0)
+	now := start
+	r := newResults(Info{Interval: time.Second})
+	r.c = make(chan Result, 1)
+	r.now = func() time.Time { return now }
+	r.history.started = start
+
+	check := func(up bool, after time.Duration) {
+		now = now.Add(after)
+		r.record(Result{Up: up})
+		<-r.c
+	}
+	// Unknown for 30 minutes, up for 90 minutes, down for 30 minutes, then up for 6 days and 22 hours.
+	check(true, 30*time.Minute)
+	check(true, 30*time.Minute)
+	check(false, 60*time.Minute)
+	check(true, 30*time.Minute)
+	now = now.Add(6*24*time.Hour + 22*time.Hour)
+
+	history := r.History()
+	if history.State != StateUp {
+		t.Errorf("expected state %s, got %s", StateUp, history.State)
+	}
+	if expected := start.Add(150 * time.Minute); !history.LastChange.Equal(expected) {
+		t.Errorf("expected last change %v, got %v", expected, history.LastChange)
+	}
+
+	week := 7 * 24 * time.Hour
+	expected := Uptime{Hour: 1, Day: 1, Week: float64(week-30*time.Minute) / float64(week)}
+	actual := history.Uptime
+	if math.Abs(actual.Hour-expected.Hour) > 1e-9 || math.Abs(actual.Day-expected.Day) > 1e-9 ||
+		math.Abs(actual.Week-expected.Week) > 1e-9 {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	// Once the down period leaves the week, the service has been up for the whole week.
+	now = now.Add(2 * time.Hour)
+	if actual := r.History().Uptime.Week; actual != 1 {
+		t.Errorf("expected weekly uptime %v, got %v", 1, actual)
+	}
+}
+
+func TestHistoryUptimeSinceStart(t *testing.T) {
+	start := time.Unix(0, 0)
+	now := start
+	r := newResults(Info{Interval: time.Second})
+	r.c = make(chan Result, 1)
+	r.now = func() time.Time { return now }
+	r.history.started = start
+
+	now = now.Add(10 * time.Minute)
+	r.record(Result{Up: true})
+	<-r.c
+	now = now.Add(30 * time.Minute)
+
+	if actual := r.History().Uptime.Hour; actual != 0.75 {
+		t.Errorf("expected hourly uptime %v, got %v", 0.75, actual)
+	}
+}
+
+func TestHistoryTransitionsPruned(t *testing.T) {
+	start := time.Unix(0, 0)
+	now := start
+	r := newResults(Info{Interval: time.Second})
+	r.c = make(chan Result, 1)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(24 * time.Hour)
+		r.record(Result{Up: i%2 == 0})
+		<-r.c
+	}
+	if len(r.history.transitions) > 8 {
+		t.Errorf("expected transitions older than a week to be pruned, got %d", len(r.history.transitions))
+	}
+}
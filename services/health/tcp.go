@@ -0,0 +1,54 @@
+package health
+
+import (
+	"net"
+	"net/url"
+)
+
+// TCP periodically checks that a service accepts TCP connections.
+type TCP struct {
+	Info
+	*results
+}
+
+// NewTCP creates a new TCP health checker.
+func NewTCP(info Info) *TCP {
+	if info.Interval == 0 {
+		info.Interval = defaultHealthInterval
+	}
+	if info.Timeout == 0 {
+		info.Timeout = defaultHealthTimeout
+	}
+	return &TCP{
+		Info:    info,
+		results: newResults(info),
+	}
+}
+
+// Launch starts the periodic health check.
+// The service is up if a connection to the host and port of its remote can be established within the timeout.
+func (t *TCP) Launch(target Target) {
+	t.launch(func() Result { return probeTarget(target, TypeTCP, t.probe) })
+}
+
+func (t *TCP) probe(remote *url.URL) Result {
+	address := tcpAddress(remote)
+	conn, err := net.DialTimeout("tcp", address, t.Timeout)
+	if err != nil {
+		return Result{Up: false, Endpoint: address, Err: err}
+	}
+	conn.Close()
+	return Result{Up: true, Endpoint: address}
+}
+
+// tcpAddress returns the host and port of a remote, using the default port of its scheme if it has none.
+func tcpAddress(remote *url.URL) string {
+	if remote.Port() != "" {
+		return remote.Host
+	}
+	port := "80"
+	if remote.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(remote.Hostname(), port)
+}
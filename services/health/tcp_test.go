@@ -0,0 +1,95 @@
+package health
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewChecker(t *testing.T) {
+	tests := map[string]struct {
+		info        Info
+		expected    Checker
+		expectedErr error
+	}{
+		"default":    {info: Info{}, expected: &Health{}},
+		"http":       {info: Info{Type: TypeHTTP}, expected: &Health{}},
+		"tcp":        {info: Info{Type: TypeTCP}, expected: &TCP{}},
+		"exec":       {info: Info{Type: TypeExec, Command: []string{"true"}}, expected: &Exec{}},
+		"no command": {info: Info{Type: TypeExec}, expectedErr: errMissingCommand},
+		"invalid":    {info: Info{Type: "udp"}, expectedErr: errInvalidType},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checker, err := NewChecker(test.info)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected %v, got %v", test.expectedErr, err)
+			}
+			if err == nil && reflect.TypeOf(checker) != reflect.TypeOf(test.expected) {
+				t.Errorf("expected %T, got %T", test.expected, checker)
+			}
+		})
+	}
+}
+
+func TestTCPAddress(t *testing.T) {
+	tests := map[string]struct {
+		remote   url.URL
+		expected string
+	}{
+		"with port": {remote: url.URL{Scheme: "http", Host: "example.com:8080"}, expected: "example.com:8080"},
+		"http":      {remote: url.URL{Scheme: "http", Host: "example.com"}, expected: "example.com:80"},
+		"https":     {remote: url.URL{Scheme: "https", Host: "example.com"}, expected: "example.com:443"},
+		"ipv6":      {remote: url.URL{Scheme: "http", Host: "[::1]"}, expected: "[::1]:80"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := tcpAddress(&test.remote); actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTCPLaunch(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen %v", err)
+	}
+	address := listener.Addr().String()
+
+	tcp := NewTCP(Info{Interval: time.Millisecond, Timeout: time.Second})
+	go tcp.Launch(remoteFunc(&url.URL{Scheme: "http", Host: address}, nil))
+
+	res := <-tcp.Check()
+	if !res.Up || !tcp.Up() || res.Endpoint != address {
+		t.Errorf("expected service to be up, got %v", res)
+	}
+
+	listener.Close()
+	waitForResult(t, tcp, false)
+}
+
+// waitForResult waits until a checker reports the expected health.
+func waitForResult(t *testing.T, checker Checker, up bool) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case res := <-checker.Check():
+			if res.Up == up {
+				if up != checker.Up() {
+					t.Errorf("expected up %v, got %v", up, checker.Up())
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for up %v", up)
+		}
+	}
+}
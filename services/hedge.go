@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/plamorg/voltproxy/logging"
+)
+
+const (
+	defaultHedgeDelay  = 100 * time.Millisecond
+	defaultHedgeBudget = 0.05
+
+	// hedgeBudgetBurst caps the number of hedged requests that can be saved up while requests are fast.
+	hedgeBudgetBurst = 10
+)
+
+// defaultHedgeMethods are the methods that are hedged if no methods are specified.
+var defaultHedgeMethods = []string{http.MethodGet, http.MethodHead}
+
+// Hedging configures hedged requests for a LoadBalancer.
+// If a service has not responded within a delay, the request is also sent to another service,
+// and whichever response arrives first is used while the other request is cancelled.
+type Hedging struct {
+	// Delay is how long to wait for response headers before hedging a request, e.g. the p95 latency.
+	Delay time.Duration
+	// Budget is the maximum number of hedged requests as a fraction of requests.
+	Budget float64
+	// Methods are the request methods that are hedged. Requests with a body are never hedged.
+	Methods []string
+}
+
+func (h *Hedging) setDefaults() {
+	if h.Delay <= 0 {
+		h.Delay = defaultHedgeDelay
+	}
+	if h.Budget <= 0 {
+		h.Budget = defaultHedgeBudget
+	}
+	if h.Methods == nil {
+		h.Methods = defaultHedgeMethods
+	}
+}
+
+// hedgeable returns whether a request may be sent to more than one service.
+func (h *Hedging) hedgeable(r *http.Request) bool {
+	return slices.Contains(h.Methods, r.Method) && (r.Body == nil || r.Body == http.NoBody)
+}
+
+// hedgeBudget limits hedged requests to a fraction of requests.
+// Every request deposits the budget fraction of a token and every hedged request takes a whole token.
+type hedgeBudget struct {
+	budget float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func (b *hedgeBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.budget, hedgeBudgetBurst)
+}
+
+func (b *hedgeBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// hedgedAttempt is one of the requests of a hedged attempt.
+type hedgedAttempt struct {
+	service *Service
+	route   *url.URL
+	req     *http.Request
+	// sent is req with a context that is cancelled once the request is no longer needed.
+	sent   *http.Request
+	cancel context.CancelCauseFunc
+
+	res  *http.Response
+	err  error
+	done bool
+}
+
+// hedge sends an attempt to the selected service, and also to another service if it has not responded
+// within the hedging delay. It returns the request whose response is used along with its outcome.
+// If the other service's response is used, the selection is moved to it.
+func (l *LoadBalancer) hedge(req *http.Request, sel *selection, timeout time.Duration) (
+	*http.Request, *http.Response, error,
+) {
+	l.hedgeBudget.deposit()
+
+	results := make(chan *hedgedAttempt, 2)
+	start := func(a *hedgedAttempt) {
+		ctx, cancel := context.WithCancelCause(a.req.Context())
+		a.sent, a.cancel = a.req.WithContext(ctx), cancel
+		go func() {
+			a.res, a.err = l.sendAttempt(a.service, a.sent, timeout)
+			results <- a
+		}()
+	}
+	primary := &hedgedAttempt{service: sel.service, route: sel.route, req: req}
+	start(primary)
+
+	timer := time.NewTimer(l.hedging.Delay)
+	defer timer.Stop()
+	var secondary *hedgedAttempt
+	var winner, last *hedgedAttempt
+	for pending := 1; pending > 0 && winner == nil; {
+		select {
+		case <-timer.C:
+			if secondary = l.hedgeAttempt(req, sel); secondary != nil {
+				logging.RequestLogger(req).Debug("Hedging request on another service",
+					slog.String("host", l.host),
+					slog.String("service", sel.service.Name),
+					slog.String("next", secondary.service.Name))
+				start(secondary)
+				pending++
+			}
+		case a := <-results:
+			pending--
+			a.done = true
+			last = a
+			if a.err == nil {
+				winner = a
+			}
+		}
+	}
+
+	// Cancel the requests whose responses are not used, and release the other service's connection
+	// unless its response is used. At most one request is still in flight.
+	for _, a := range []*hedgedAttempt{primary, secondary} {
+		if a == nil || a == winner {
+			continue
+		}
+		a.cancel(nil)
+		go func(a *hedgedAttempt) {
+			if !a.done {
+				<-results
+				if a.err == nil {
+					a.res.Body.Close()
+				}
+			}
+			if a == secondary {
+				a.service.Limit.release()
+			}
+		}(a)
+	}
+
+	if winner == nil {
+		return req, nil, last.err
+	}
+	if winner == secondary {
+		sel.claim(secondary.service.Limit)
+		sel.service = secondary.service
+		sel.route = secondary.route
+	}
+	winner.res.Body = &cancelBody{ReadCloser: winner.res.Body, cancel: winner.cancel}
+	return winner.req, winner.res, nil
+}
+
+// hedgeAttempt picks another service for a hedged request and claims a connection to it.
+// It returns nil if there is no other available service or the budget is exhausted.
+func (l *LoadBalancer) hedgeAttempt(req *http.Request, sel *selection) *hedgedAttempt {
+	next, err := l.selectUntried(req, []*Service{sel.service})
+	if err != nil {
+		return nil
+	}
+	route, err := next.Router.Route(nil, req) // Load balancers do not nest, so the writer is unused.
+	if err != nil || !next.Limit.tryAcquire() {
+		return nil
+	}
+	// The budget is only spent once the hedged request can be sent.
+	if !l.hedgeBudget.take() {
+		next.Limit.release()
+		return nil
+	}
+	return &hedgedAttempt{service: next, route: route, req: retarget(req, sel.route, route)}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func TestHedgeBudget(t *testing.T) {
+	b := &hedgeBudget{budget: 0.25}
+	taken := 0
+	for i := 0; i < 8; i++ {
+		b.deposit()
+		if b.take() {
+			taken++
+		}
+	}
+	if taken != 2 {
+		t.Errorf("expected %d hedged requests, got %d", 2, taken)
+	}
+
+	for i := 0; i < 1000; i++ {
+		b.deposit()
+	}
+	if b.tokens != hedgeBudgetBurst {
+		t.Errorf("expected budget to be capped at %d, got %v", hedgeBudgetBurst, b.tokens)
+	}
+}
+
+func TestLoadBalancerHedging(t *testing.T) {
+	tests := map[string]struct {
+		method   string
+		budget   float64
+		expected int
+	}{
+		"hedged":           {method: http.MethodGet, budget: 1, expected: http.StatusOK},
+		"budget exhausted": {method: http.MethodGet, budget: 0.01, expected: http.StatusInternalServerError},
+		"not hedgeable":    {method: http.MethodPost, budget: 1, expected: http.StatusInternalServerError},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fast := &Service{
+				Name:   "fast",
+				Health: health.Always(true),
+				Limit:  NewConnectionLimit(1),
+				Router: NewRedirect(statusServerURL(t, http.StatusOK, 0)),
+			}
+			lb := NewLoadBalancer("example.com", &Failover{}, []*Service{
+				{
+					Name:   "slow",
+					Health: health.Always(true),
+					Router: NewRedirect(statusServerURL(t, http.StatusInternalServerError, 50*time.Millisecond)),
+				},
+				fast,
+			}, LoadBalancerOptions{Hedging: &Hedging{Delay: 5 * time.Millisecond, Budget: test.budget}})
+			services := map[string]*Service{"example.com": {Router: lb}}
+
+			w, r := httptest.NewRecorder(), httptest.NewRequest(test.method, "http://example.com", nil)
+			Handler(services).ServeHTTP(w, r)
+			if w.Code != test.expected {
+				t.Errorf("expected code %d, got %d", test.expected, w.Code)
+			}
+			waitFor(t, func() bool { return !fast.Limit.full() })
+		})
+	}
+}
+
+func TestLoadBalancerHedgingCancelsSlowRequest(t *testing.T) {
+	slowRemote, unblock := blockingServerURL(t, http.StatusOK)
+	defer unblock()
+	slow := &Service{
+		Name:   "slow",
+		Health: health.Always(true),
+		Limit:  NewConnectionLimit(1),
+		Router: NewRedirect(slowRemote),
+	}
+	lb := NewLoadBalancer("example.com", &Failover{}, []*Service{
+		{
+			Name:   "primary",
+			Health: health.Always(true),
+			Router: NewRedirect(statusServerURL(t, http.StatusAccepted, 20*time.Millisecond)),
+		},
+		slow,
+	}, LoadBalancerOptions{Hedging: &Hedging{Delay: time.Millisecond, Budget: 1}})
+	services := map[string]*Service{"example.com": {Router: lb}}
+
+	w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	Handler(services).ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected code %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	// The hedged request to the slow service is cancelled and its connection released.
+	waitFor(t, func() bool { return !slow.Limit.full() })
+}
+
+// racingRouter fills the connection limit of its service while routing to it,
+// as if another request had claimed the last connection in the meantime.
+type racingRouter struct {
+	limit *ConnectionLimit
+}
+
+func (r racingRouter) Route(http.ResponseWriter, *http.Request) (*url.URL, error) {
+	r.limit.tryAcquire()
+	return &url.URL{Host: "limited.internal"}, nil
+}
+
+func TestHedgeAttemptAtConnectionLimit(t *testing.T) {
+	slow := &Service{Name: "slow", Health: health.Always(true), Router: NewRedirect(url.URL{Host: "slow.internal"})}
+	limit := NewConnectionLimit(1)
+	limited := &Service{Name: "limited", Health: health.Always(true), Limit: limit, Router: racingRouter{limit}}
+	lb := NewLoadBalancer("example.com", &Failover{}, []*Service{slow, limited},
+		LoadBalancerOptions{Hedging: &Hedging{Budget: 1}})
+	lb.hedgeBudget.deposit()
+
+	sel := &selection{service: slow, route: &url.URL{Host: "slow.internal"}}
+	if a := lb.hedgeAttempt(httptest.NewRequest(http.MethodGet, "http://example.com", nil), sel); a != nil {
+		t.Fatalf("expected no hedged attempt on a service at its connection limit, got %s", a.service.Name)
+	}
+	if lb.hedgeBudget.tokens != 1 {
+		t.Errorf("expected the hedging budget to be kept, got %v tokens", lb.hedgeBudget.tokens)
+	}
+}
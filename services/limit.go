@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	errQueueFull    = fmt.Errorf("%w: queue is full", errNoAvailableService)
+	errQueueTimeout = fmt.Errorf("%w: timed out waiting in queue", errNoAvailableService)
+)
+
+// ConnectionLimit limits the number of concurrent requests that load balancers proxy to a service.
+// A nil ConnectionLimit does not limit anything.
+type ConnectionLimit struct {
+	max int
+
+	mu          sync.Mutex
+	active      int
+	subscribers []func()
+}
+
+// NewConnectionLimit creates a ConnectionLimit that allows max concurrent requests.
+func NewConnectionLimit(max int) *ConnectionLimit {
+	return &ConnectionLimit{max: max}
+}
+
+// full returns whether the limit has been reached.
+func (c *ConnectionLimit) full() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active >= c.max
+}
+
+// tryAcquire claims a connection if the limit has not been reached.
+func (c *ConnectionLimit) tryAcquire() bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active >= c.max {
+		return false
+	}
+	c.active++
+	return true
+}
+
+// release releases a connection claimed by tryAcquire and notifies the subscribers.
+func (c *ConnectionLimit) release() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.active--
+	subscribers := c.subscribers
+	c.mu.Unlock()
+	for _, notify := range subscribers {
+		notify()
+	}
+}
+
+// subscribe registers a function that is called whenever a connection is released.
+func (c *ConnectionLimit) subscribe(notify func()) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, notify)
+}
+
+const (
+	defaultQueueSize    = 100
+	defaultQueueTimeout = 10 * time.Second
+)
+
+// Queue configures how requests wait when every healthy service of a LoadBalancer is at its connection limit.
+type Queue struct {
+	// Size is the maximum number of waiting requests. Requests beyond this are rejected immediately.
+	Size int
+	// Timeout is how long a request waits for a connection before it is rejected.
+	Timeout time.Duration
+}
+
+// waitQueue is a bounded queue of requests waiting for a connection to be released.
+type waitQueue struct {
+	Queue
+	host string
+
+	mu       sync.Mutex
+	waiting  int
+	released chan struct{}
+}
+
+func newWaitQueue(host string, queue Queue) *waitQueue {
+	if queue.Size <= 0 {
+		queue.Size = defaultQueueSize
+	}
+	if queue.Timeout <= 0 {
+		queue.Timeout = defaultQueueTimeout
+	}
+	return &waitQueue{
+		Queue:    queue,
+		host:     host,
+		released: make(chan struct{}),
+	}
+}
+
+// notify wakes up all waiting requests.
+func (q *waitQueue) notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	close(q.released)
+	q.released = make(chan struct{})
+}
+
+func (q *waitQueue) join() (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waiting >= q.Size {
+		return q.waiting, false
+	}
+	q.waiting++
+	return q.waiting, true
+}
+
+func (q *waitQueue) leave() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waiting--
+}
+
+func (q *waitQueue) signal() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.released
+}
+
+// wait calls acquire every time a connection is released until it succeeds,
+// giving up once the queue's timeout has passed. The logger is that of the waiting request.
+func (q *waitQueue) wait(ctx context.Context, logger *slog.Logger, acquire func() (*Service, error)) (*Service, error) {
+	logger = logger.With(slog.String("host", q.host))
+
+	depth, ok := q.join()
+	if !ok {
+		logger.Warn("Rejecting request, queue is full", slog.Int("depth", depth))
+		return nil, errQueueFull
+	}
+	defer q.leave()
+	logger.Debug("Waiting in queue for a connection", slog.Int("depth", depth))
+
+	start := time.Now()
+	timer := time.NewTimer(q.Timeout)
+	defer timer.Stop()
+	for {
+		released := q.signal()
+		service, err := acquire()
+		if err == nil {
+			logger.Debug("Acquired connection after waiting in queue",
+				slog.Duration("wait", time.Since(start)), slog.Int("depth", depth))
+			return service, nil
+		}
+		if !errors.Is(err, errNoAvailableService) {
+			return nil, err
+		}
+
+		select {
+		case <-released:
+		case <-timer.C:
+			logger.Warn("Timed out waiting in queue for a connection",
+				slog.Duration("wait", time.Since(start)), slog.Int("depth", depth))
+			return nil, errQueueTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
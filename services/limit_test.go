@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func TestConnectionLimit(t *testing.T) {
+	c := NewConnectionLimit(2)
+	notified := 0
+	c.subscribe(func() { notified++ })
+
+	if !c.tryAcquire() || !c.tryAcquire() {
+		t.Fatalf("expected to acquire connections below the limit")
+	}
+	if !c.full() || c.tryAcquire() {
+		t.Fatalf("expected limit to be reached")
+	}
+
+	c.release()
+	if c.full() || notified != 1 {
+		t.Fatalf("expected released connection to notify subscribers")
+	}
+	if !c.tryAcquire() {
+		t.Fatalf("expected to acquire released connection")
+	}
+}
+
+func TestConnectionLimitNil(t *testing.T) {
+	var c *ConnectionLimit
+	c.subscribe(func() {})
+	if c.full() || !c.tryAcquire() {
+		t.Errorf("expected nil limit to not limit anything")
+	}
+	c.release()
+}
+
+func TestWaitQueue(t *testing.T) {
+	service := &Service{Name: "foo"}
+	errFull := errNoAvailableService
+
+	t.Run("acquire after release", func(t *testing.T) {
+		q := newWaitQueue("host", Queue{Size: 1, Timeout: time.Second})
+		attempts := 0
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			q.notify()
+		}()
+		actual, err := q.wait(context.Background(), slog.Default(), func() (*Service, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, errFull
+			}
+			return service, nil
+		})
+		if err != nil || actual != service {
+			t.Errorf("expected %v, got %v (error %v)", service, actual, err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		q := newWaitQueue("host", Queue{Size: 1, Timeout: 10 * time.Millisecond})
+		_, err := q.wait(context.Background(), slog.Default(), func() (*Service, error) { return nil, errFull })
+		if !errors.Is(err, errQueueTimeout) || !errors.Is(err, errNoAvailableService) {
+			t.Errorf("expected %v, got %v", errQueueTimeout, err)
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		q := newWaitQueue("host", Queue{Size: 1, Timeout: time.Second})
+		q.waiting = 1
+		_, err := q.wait(context.Background(), slog.Default(), func() (*Service, error) { return service, nil })
+		if !errors.Is(err, errQueueFull) || !errors.Is(err, errNoAvailableService) {
+			t.Errorf("expected %v, got %v", errQueueFull, err)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		q := newWaitQueue("host", Queue{Size: 1, Timeout: time.Second})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := q.wait(ctx, slog.Default(), func() (*Service, error) { return nil, errFull })
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+// blockingServerURL returns the URL of a server that blocks requests until unblock is called.
+func blockingServerURL(t *testing.T, status int) (remote url.URL, unblock func()) {
+	t.Helper()
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		w.WriteHeader(status)
+	}))
+	var once sync.Once
+	unblock = func() { once.Do(func() { close(block) }) }
+	t.Cleanup(func() {
+		unblock()
+		server.Close()
+	})
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *u, unblock
+}
+
+func TestLoadBalancerConnectionLimit(t *testing.T) {
+	busyRemote, unblockBusy := blockingServerURL(t, http.StatusOK)
+	busy := &Service{
+		Name:   "busy",
+		Health: health.Always(true),
+		Limit:  NewConnectionLimit(1),
+		Router: NewRedirect(busyRemote),
+	}
+	idle := &Service{
+		Name:   "idle",
+		Health: health.Always(true),
+		Limit:  NewConnectionLimit(1),
+		Router: NewRedirect(statusServerURL(t, http.StatusAccepted, 0)),
+	}
+	lb := NewLoadBalancer("example.com", &Failover{}, []*Service{busy, idle}, LoadBalancerOptions{})
+	services := map[string]*Service{"example.com": {Router: lb}}
+
+	done := make(chan int)
+	go func() {
+		w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		Handler(services).ServeHTTP(w, r)
+		done <- w.Code
+	}()
+	waitFor(t, busy.Limit.full)
+
+	// The first service is at its limit, so it is skipped.
+	w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	Handler(services).ServeHTTP(w, r)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected code %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	unblockBusy()
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("expected code %d, got %d", http.StatusOK, code)
+	}
+	if busy.Limit.full() || idle.Limit.full() {
+		t.Errorf("expected connections to be released")
+	}
+}
+
+func TestLoadBalancerQueue(t *testing.T) {
+	remote, unblock := blockingServerURL(t, http.StatusOK)
+	service := &Service{
+		Name:   "foo",
+		Health: health.Always(true),
+		Limit:  NewConnectionLimit(1),
+		Router: NewRedirect(remote),
+	}
+
+	tests := map[string]struct {
+		queue        *Queue
+		expectedCode int
+	}{
+		"no queue": {
+			queue:        nil,
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		"queue timeout": {
+			queue:        &Queue{Size: 1, Timeout: 10 * time.Millisecond},
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			lb := NewLoadBalancer("example.com", &RoundRobin{}, []*Service{service}, LoadBalancerOptions{Queue: test.queue})
+			services := map[string]*Service{"example.com": {Router: lb}}
+
+			if !service.Limit.tryAcquire() {
+				t.Fatalf("expected to acquire connection")
+			}
+			defer service.Limit.release()
+
+			w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+			Handler(services).ServeHTTP(w, r)
+			if w.Code != test.expectedCode {
+				t.Errorf("expected code %d, got %d", test.expectedCode, w.Code)
+			}
+		})
+	}
+
+	t.Run("queued until released", func(t *testing.T) {
+		lb := NewLoadBalancer("example.com", &RoundRobin{}, []*Service{service}, LoadBalancerOptions{
+			Queue: &Queue{Size: 1, Timeout: 5 * time.Second},
+		})
+		services := map[string]*Service{"example.com": {Router: lb}}
+
+		codes := make(chan int, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+				Handler(services).ServeHTTP(w, r)
+				codes <- w.Code
+			}()
+		}
+		waitFor(t, func() bool {
+			lb.queue.mu.Lock()
+			defer lb.queue.mu.Unlock()
+			return lb.queue.waiting == 1
+		})
+
+		unblock()
+		for i := 0; i < 2; i++ {
+			if code := <-codes; code != http.StatusOK {
+				t.Errorf("expected code %d, got %d", http.StatusOK, code)
+			}
+		}
+	})
+}
+
+// waitFor waits until condition returns true, failing the test if it takes too long.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+const (
+	defaultLoadHeader  = "X-Backend-Load"
+	defaultLoadDamping = 10 * time.Second
+
+	// loadMinWeight is the weight of a fully loaded service, so that it still receives some traffic
+	// and gets to report when it is no longer loaded.
+	loadMinWeight = 0.1
+)
+
+// LoadFeedback adjusts the weights of services in a LoadBalancer based on the load they report.
+// Services report their load between 0 (idle) and 1 (fully loaded) in a response header,
+// or through their health check (see health.Info.LoadHeader). A service's weight is reduced
+// in proportion to its load.
+type LoadFeedback struct {
+	// Header is the response header services report their load in.
+	Header string
+	// Damping is the time constant with which the tracked load follows reported loads.
+	// After this long, the tracked load has moved about 63% of the way to a newly reported load,
+	// which avoids weights oscillating as services report their load.
+	Damping time.Duration
+}
+
+func (l *LoadFeedback) setDefaults() {
+	if l.Header == "" {
+		l.Header = defaultLoadHeader
+	}
+	if l.Damping <= 0 {
+		l.Damping = defaultLoadDamping
+	}
+}
+
+// load tracks the damped load of a service as an exponentially weighted moving average over time.
+type load struct {
+	damping time.Duration
+
+	mu      sync.Mutex
+	value   float64
+	updated time.Time
+}
+
+// observe moves the tracked load towards a reported load depending on the time since the last report.
+// The first reported load is taken as is.
+func (l *load) observe(reported float64, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.updated.IsZero() {
+		l.value = reported
+	} else if elapsed := now.Sub(l.updated); elapsed > 0 {
+		l.value += (reported - l.value) * (1 - math.Exp(-float64(elapsed)/float64(l.damping)))
+	}
+	l.updated = now
+}
+
+// observeResponse observes the load reported in a response header, if any.
+func (l *load) observeResponse(res *http.Response, header string, now time.Time) {
+	if res == nil {
+		return
+	}
+	if reported, ok := health.ParseLoad(res.Header.Get(header)); ok {
+		l.observe(reported, now)
+	}
+}
+
+// weight returns the weight of the service given its tracked load.
+func (l *load) weight() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return max(loadMinWeight, 1-l.value)
+}
+
+// loadReporter is implemented by health checkers that poll the load of a service.
+type loadReporter interface {
+	Load() (float64, bool)
+}
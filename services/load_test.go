@@ -0,0 +1,105 @@
+package services
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func TestLoadObserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := &load{damping: 10 * time.Second}
+
+	// The first reported load is taken as is.
+	l.observe(0.8, now)
+	if l.value != 0.8 {
+		t.Fatalf("expected load %v, got %v", 0.8, l.value)
+	}
+
+	// Reports in quick succession barely move the tracked load.
+	now = now.Add(time.Millisecond)
+	l.observe(0, now)
+	if l.value < 0.79 {
+		t.Errorf("expected damped load, got %v", l.value)
+	}
+
+	// After the damping time, the load has moved about 63% of the way.
+	l.value = 0.8
+	l.observe(0, now.Add(10*time.Second))
+	if expected := 0.8 / math.E; math.Abs(l.value-expected) > 1e-9 {
+		t.Errorf("expected load %v, got %v", expected, l.value)
+	}
+}
+
+func TestLoadWeight(t *testing.T) {
+	tests := map[string]struct {
+		load     float64
+		expected float64
+	}{
+		"idle":         {load: 0, expected: 1},
+		"half loaded":  {load: 0.5, expected: 0.5},
+		"fully loaded": {load: 1, expected: loadMinWeight},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			l := &load{value: test.load}
+			if actual := l.weight(); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+// loadHealth is a health checker that reports a fixed load.
+type loadHealth struct {
+	health.Always
+	load float64
+}
+
+func (l loadHealth) Load() (float64, bool) {
+	return l.load, true
+}
+
+func TestMemberPolledLoad(t *testing.T) {
+	m := newMember(&Service{Name: "foo", Health: loadHealth{Always: true, load: 0.75}}, LoadBalancerOptions{
+		LoadFeedback: &LoadFeedback{Damping: time.Second},
+	})
+	if actual := m.Weight(); actual != 0.25 {
+		t.Errorf("expected weight %v, got %v", 0.25, actual)
+	}
+}
+
+func TestLoadBalancerLoadFeedback(t *testing.T) {
+	loaded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Load", "0.9")
+	}))
+	defer loaded.Close()
+	loadedURL, err := url.Parse(loaded.URL)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	lb := NewLoadBalancer("example.com", &RoundRobin{}, []*Service{
+		{Name: "loaded", Health: health.Always(true), Router: NewRedirect(*loadedURL)},
+		{Name: "idle", Health: health.Always(true), Router: NewRedirect(statusServerURL(t, http.StatusOK, 0))},
+	}, LoadBalancerOptions{LoadFeedback: &LoadFeedback{Header: "X-Load", Damping: time.Hour}})
+	services := map[string]*Service{"example.com": {Router: lb}}
+
+	for i := 0; i < 2; i++ {
+		w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		Handler(services).ServeHTTP(w, r)
+	}
+
+	if actual := weight(lb.services[0]); math.Abs(actual-0.1) > 1e-9 {
+		t.Errorf("expected loaded service to have weight %v, got %v", 0.1, actual)
+	}
+	if actual := weight(lb.services[1]); actual != 1 {
+		t.Errorf("expected idle service to have full weight, got %v", actual)
+	}
+}
@@ -1,11 +1,18 @@
 package services
 
 import (
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"strconv"
+	"slices"
+	"time"
+
+	"github.com/plamorg/voltproxy/logging"
+	"github.com/plamorg/voltproxy/services/health"
 )
 
 var errNoServices = fmt.Errorf("no services in pool")
@@ -13,17 +20,91 @@ var errNoServices = fmt.Errorf("no services in pool")
 const (
 	lbCookiePrefix     = "voltproxy-lb-"
 	lbCookieNameLength = 8
-	lbCookieBase       = 10
-	lbCookieBitSize    = 64
 )
 
+// LoadBalancerOptions configures the optional behaviour of a LoadBalancer.
+type LoadBalancerOptions struct {
+	// Persistence persists client sessions through cookies. If nil, sessions are not persisted.
+	Persistence *Persistence
+	// Retry retries failed requests on other services. If nil, requests are not retried.
+	Retry *RetryPolicy
+	// OutlierDetection ejects services whose proxied requests keep failing.
+	// If nil, only active health checks decide whether a service is up.
+	OutlierDetection *OutlierDetection
+	// SlowStart is how long it takes for a service that came back up to receive its full share of traffic.
+	// If zero, recovered services immediately receive their full share.
+	SlowStart time.Duration
+	// Queue lets requests wait when every healthy service is at its connection limit.
+	// If nil, such requests are rejected immediately.
+	Queue *Queue
+	// LoadFeedback adjusts the weights of services based on the load they report.
+	// If nil, reported loads are ignored.
+	LoadFeedback *LoadFeedback
+	// Canary gradually rolls out one of the services, which is otherwise selected by the strategy.
+	// If nil, all services are selected by the strategy.
+	Canary *Canary
+	// Hedging sends slow requests to a second service as well. If nil, requests are not hedged.
+	Hedging *Hedging
+}
+
+func (o LoadBalancerOptions) needsMembers() bool {
+	return o.OutlierDetection != nil || o.SlowStart > 0 || o.LoadFeedback != nil
+}
+
 // LoadBalancer is a service that load balances between other services.
 type LoadBalancer struct {
-	cookieName string
+	host string
+
+	strategy    Strategy
+	persistence *Persistence
+	retry       *RetryPolicy
+	rollout     *rollout
+	hedging     *Hedging
+	hedgeBudget *hedgeBudget
+	// services are the services in the pool as seen by the load balancer.
+	// With outlier detection or slow start, each service's health checker is wrapped in a member.
+	services []*Service
+	// backends are the services as given to the load balancer, whose health checkers are their own.
+	backends []*Service
+	drained  *drainSet
+	queue    *waitQueue
+
+	transport http.RoundTripper
+}
+
+// selection records the service a LoadBalancer routed a request to.
+// The handler attaches the same selection to the request context when routing and when proxying.
+type selection struct {
+	service  *Service
+	route    *url.URL
+	attempts int
+	// limit is the connection limit on which a connection has been claimed for the request.
+	limit *ConnectionLimit
+}
+
+// claim records a connection claimed on limit, releasing any previously claimed connection.
+func (s *selection) claim(limit *ConnectionLimit) {
+	s.release()
+	s.limit = limit
+}
+
+// release releases the claimed connection, if any.
+func (s *selection) release() {
+	if s.limit != nil {
+		s.limit.release()
+		s.limit = nil
+	}
+}
+
+type selectionKey struct{}
 
-	strategy   Strategy
-	persistent bool
-	services   []*Service
+func withSelection(ctx context.Context, sel *selection) context.Context {
+	return context.WithValue(ctx, selectionKey{}, sel)
+}
+
+func selectionFromContext(ctx context.Context) *selection {
+	sel, _ := ctx.Value(selectionKey{}).(*selection)
+	return sel
 }
 
 func generateCookieName(host string) string {
@@ -34,43 +115,298 @@ func generateCookieName(host string) string {
 }
 
 // NewLoadBalancer creates a new load balancer service.
-func NewLoadBalancer(host string, strategy Strategy, persistent bool, services []*Service) *LoadBalancer {
+func NewLoadBalancer(host string, strategy Strategy, services []*Service, options LoadBalancerOptions) *LoadBalancer {
+	if options.Persistence != nil {
+		options.Persistence.setDefaults(host)
+	}
+	if options.Retry != nil {
+		options.Retry.setDefaults()
+	}
+	if options.OutlierDetection != nil {
+		options.OutlierDetection.setDefaults()
+	}
+	if options.LoadFeedback != nil {
+		options.LoadFeedback.setDefaults()
+	}
+	backends := services
+	if options.needsMembers() {
+		services = membersOf(services, options)
+	}
+	var queue *waitQueue
+	if options.Queue != nil {
+		queue = newWaitQueue(host, *options.Queue)
+		for _, service := range services {
+			service.Limit.subscribe(queue.notify)
+		}
+	}
+	var budget *hedgeBudget
+	if options.Hedging != nil {
+		options.Hedging.setDefaults()
+		budget = &hedgeBudget{budget: options.Hedging.Budget}
+	}
+	var canary *rollout
+	if options.Canary != nil {
+		canary = newRollout(host, strategy, *options.Canary)
+		strategy = canary
+	}
 	return &LoadBalancer{
-		cookieName: generateCookieName(host),
-		strategy:   strategy,
-		persistent: persistent,
-		services:   services,
+		host:        host,
+		strategy:    strategy,
+		persistence: options.Persistence,
+		retry:       options.Retry,
+		rollout:     canary,
+		hedging:     options.Hedging,
+		hedgeBudget: budget,
+		services:    services,
+		backends:    backends,
+		drained:     drainSetOf(host),
+		queue:       queue,
+		transport:   http.DefaultTransport,
 	}
 }
 
-func (l *LoadBalancer) persistentService(w http.ResponseWriter, r *http.Request) (*url.URL, error) {
-	if cookie, err := r.Cookie(l.cookieName); err == nil {
-		cookieNext, err := strconv.ParseUint(cookie.Value, lbCookieBase, lbCookieBitSize)
-		validCookie := err == nil && cookieNext < uint64(len(l.services))
+func (l *LoadBalancer) serviceByName(name string) *Service {
+	for _, service := range l.services {
+		if service.Name == name {
+			return service
+		}
+	}
+	return nil
+}
 
-		if validCookie && l.services[cookieNext].Health.Up() {
-			return l.services[cookieNext].Router.Route(w, r)
+// routeService routes the request to the given service and records the selection.
+func (l *LoadBalancer) routeService(w http.ResponseWriter, r *http.Request, service *Service) (*url.URL, error) {
+	route, err := service.Router.Route(w, r)
+	if err != nil {
+		return nil, err
+	}
+	if sel := selectionFromContext(r.Context()); sel != nil {
+		sel.service = service
+		sel.route = route
+	}
+	return route, nil
+}
+
+// Members returns the health checkers of the services in the pool as seen by the load balancer,
+// from which the health of the load balancer is computed. Drained services are down.
+func (l *LoadBalancer) Members() []health.Checker {
+	members := make([]health.Checker, len(l.services))
+	for i, service := range l.services {
+		members[i] = drainable{Checker: service.Health, lb: l, name: service.Name}
+	}
+	return members
+}
+
+// anyUp returns whether any service is healthy, regardless of connection limits.
+func (l *LoadBalancer) anyUp() bool {
+	for _, service := range l.pool() {
+		if service.Health.Up() {
+			return true
+		}
+	}
+	return false
+}
+
+// tryAcquire picks a service for the request and claims a connection to it.
+// The preferred service is picked if it is available.
+// Only requests that are being proxied, i.e. that have a selection, claim a connection.
+func (l *LoadBalancer) tryAcquire(r *http.Request, preferred *Service) (*Service, error) {
+	sel := selectionFromContext(r.Context())
+	for {
+		service := preferred
+		if service == nil || !available(service) {
+			pool := l.pool()
+			next, err := l.strategy.Select(pool, r)
+			if err != nil {
+				return nil, err
+			}
+			service = pool[next]
+		}
+		if sel == nil {
+			return service, nil
 		}
+		// Another request may have claimed the last connection since the service was picked.
+		if service.Limit.tryAcquire() {
+			sel.claim(service.Limit)
+			return service, nil
+		}
+	}
+}
+
+// acquire is like tryAcquire, but waits in the queue if every healthy service is at its connection limit.
+func (l *LoadBalancer) acquire(r *http.Request, preferred *Service) (*Service, error) {
+	service, err := l.tryAcquire(r, preferred)
+	if !errors.Is(err, errNoAvailableService) || l.queue == nil || !l.anyUp() {
+		return service, err
 	}
+	return l.queue.wait(r.Context(), logging.RequestLogger(r), func() (*Service, error) {
+		return l.tryAcquire(r, preferred)
+	})
+}
 
-	next := l.strategy.Select(l.services, r)
-	cookie := &http.Cookie{
-		Name:     l.cookieName,
-		Value:    fmt.Sprint(next),
-		HttpOnly: true,
+// cookieService returns the service identified by the request's persistence cookie, if any.
+func (l *LoadBalancer) cookieService(r *http.Request) *Service {
+	cookie, err := r.Cookie(l.persistence.CookieName)
+	if err != nil {
+		return nil
+	}
+	name, err := l.persistence.verify(cookie.Value)
+	if err != nil {
+		logging.RequestLogger(r).Warn("Ignoring tampered persistence cookie",
+			slog.String("host", l.host),
+			slog.String("remoteAddr", r.RemoteAddr),
+			slog.Any("error", err))
+		return nil
+	}
+	if (l.rollout != nil && !l.rollout.admits(name)) || l.Drained(name) {
+		return nil
+	}
+	return l.serviceByName(name)
+}
+
+func (l *LoadBalancer) persistentService(w http.ResponseWriter, r *http.Request) (*url.URL, error) {
+	preferred := l.cookieService(r)
+	service, err := l.acquire(r, preferred)
+	if err != nil {
+		return nil, err
 	}
-	http.SetCookie(w, cookie)
-	return l.services[next].Router.Route(w, r)
+	if service != preferred {
+		http.SetCookie(w, l.persistence.cookie(service.Name))
+	}
+	return l.routeService(w, r, service)
 }
 
 // Route returns the remote URL of the next service in the load balancer.
+// If no service in the pool is available, errNoAvailableService is returned.
 func (l *LoadBalancer) Route(w http.ResponseWriter, r *http.Request) (*url.URL, error) {
 	if len(l.services) == 0 {
 		return nil, errNoServices
 	}
-	if l.persistent {
+	if l.persistence != nil {
 		return l.persistentService(w, r)
 	}
-	next := l.strategy.Select(l.services, r)
-	return l.services[next].Router.Route(w, r)
+	service, err := l.acquire(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return l.routeService(w, r, service)
+}
+
+// selectUntried selects the next service that is not in tried and not drained.
+// Tried services are replaced rather than removed so that strategies see the same indices.
+func (l *LoadBalancer) selectUntried(r *http.Request, tried []*Service) (*Service, error) {
+	pool := l.pool()
+	untried := make([]*Service, len(pool))
+	for i, service := range pool {
+		untried[i] = service
+		if slices.Contains(tried, service) {
+			untried[i] = unavailableService
+		}
+	}
+	next, err := l.strategy.Select(untried, r)
+	if err != nil {
+		return nil, err
+	}
+	return untried[next], nil
+}
+
+// sendAttempt sends a single attempt to a service and reports its outcome
+// to outlier detection and canary rollouts.
+func (l *LoadBalancer) sendAttempt(service *Service, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	start := time.Now()
+	res, err := roundTripAttempt(l.transport, req, timeout)
+	reportAttempt(service, req, res, err)
+	if l.rollout != nil {
+		l.rollout.observe(service, failedAttempt(req, res, err), time.Since(start))
+	}
+	return res, err
+}
+
+// noRetry is the retry policy used by load balancers without a retry policy.
+var noRetry = &RetryPolicy{Attempts: 1}
+
+// RoundTrip sends a proxied request to the service it was routed to.
+// Failed attempts are retried on other services according to the load balancer's retry policy,
+// and the outcome of every attempt is reported to outlier detection and canary rollouts.
+// Slow attempts are hedged on another service if the load balancer has hedging.
+func (l *LoadBalancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	sel := selectionFromContext(req.Context())
+	if sel == nil || sel.service == nil {
+		return l.transport.RoundTrip(req)
+	}
+	policy := l.retry
+	if policy == nil {
+		policy = noRetry
+	}
+
+	logger := logging.RequestLogger(req).With(slog.String("host", l.host))
+	retryable := policy.retryableRequest(req)
+	tried := []*Service{sel.service}
+	for {
+		sel.attempts++
+		var res *http.Response
+		var err error
+		if l.hedging != nil && l.hedging.hedgeable(req) {
+			req, res, err = l.hedge(req, sel, policy.Timeout)
+		} else {
+			res, err = l.sendAttempt(sel.service, req, policy.Timeout)
+		}
+
+		attemptLogger := logger.With(
+			slog.String("service", sel.service.Name),
+			slog.Int("attempt", sel.attempts))
+		if !retryable || sel.attempts >= policy.Attempts || !policy.retryableResult(res, err) {
+			if err != nil {
+				attemptLogger.Warn("Request to service failed", slog.Any("error", err))
+				return nil, err
+			}
+			attemptLogger.Debug("Service responded", slog.Int("status", res.StatusCode))
+			l.setAttemptsHeader(res, sel.attempts)
+			return res, nil
+		}
+
+		next, selectErr := l.selectUntried(req, tried)
+		var route *url.URL
+		if selectErr == nil {
+			route, selectErr = next.Router.Route(nil, req) // Load balancers do not nest, so the writer is unused.
+		}
+		if selectErr == nil && !next.Limit.tryAcquire() {
+			selectErr = errNoAvailableService
+		}
+		if selectErr != nil {
+			attemptLogger.Debug("No other service to retry on", slog.Any("error", selectErr))
+			if err != nil {
+				return nil, err
+			}
+			l.setAttemptsHeader(res, sel.attempts)
+			return res, nil
+		}
+
+		if err != nil {
+			attemptLogger.Warn("Retrying failed request on another service",
+				slog.Any("error", err), slog.String("next", next.Name))
+		} else {
+			attemptLogger.Warn("Retrying request on another service",
+				slog.Int("status", res.StatusCode), slog.String("next", next.Name))
+			res.Body.Close()
+		}
+
+		if err := sleepContext(req.Context(), policy.backoff(len(tried))); err != nil {
+			// The connection acquired for the next attempt is not claimed by the selection yet.
+			next.Limit.release()
+			return nil, err
+		}
+
+		req = retarget(req, sel.route, route)
+		sel.claim(next.Limit)
+		sel.service = next
+		sel.route = route
+		tried = append(tried, next)
+	}
+}
+
+func (l *LoadBalancer) setAttemptsHeader(res *http.Response, attempts int) {
+	if l.retry != nil {
+		res.Header.Set(attemptsHeader, fmt.Sprint(attempts))
+	}
 }
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/plamorg/voltproxy/services/health"
 )
@@ -20,20 +21,23 @@ func TestGenerateCookieName(t *testing.T) {
 }
 
 func TestLoadBalancerPersistentService(t *testing.T) {
-	lb := NewLoadBalancer("host", &Failover{}, true, []*Service{})
+	persistence := &Persistence{Key: []byte("secret")}
+	lb := NewLoadBalancer("host", &Failover{}, []*Service{}, LoadBalancerOptions{Persistence: persistence})
+	forged := &Persistence{CookieName: persistence.CookieName, Key: []byte("forged")}
 	tests := map[string]struct {
 		cookie      *http.Cookie
 		services    []*Service
 		expectedURL string
 		expectedErr error
 	}{
-		"cookie value out of bounds": {
+		"unknown service name": {
 			cookie: &http.Cookie{
-				Name:  lb.cookieName,
-				Value: "5",
+				Name:  persistence.CookieName,
+				Value: persistence.sign("unknown"),
 			},
 			services: []*Service{
 				{
+					Name:   "foo",
 					Health: health.Always(true),
 					Router: NewRedirect(url.URL{Scheme: "http", Host: "example.com"}),
 				},
@@ -43,10 +47,12 @@ func TestLoadBalancerPersistentService(t *testing.T) {
 		"no cookie": {
 			services: []*Service{
 				{
+					Name:   "foo",
 					Health: health.Always(true),
 					Router: NewRedirect(url.URL{Scheme: "http", Host: "foo.example.com"}),
 				},
 				{
+					Name:   "bar",
 					Health: health.Always(true),
 					Router: NewRedirect(url.URL{Scheme: "http", Host: "bar.example.com"}),
 				},
@@ -55,21 +61,75 @@ func TestLoadBalancerPersistentService(t *testing.T) {
 		},
 		"with cookie": {
 			cookie: &http.Cookie{
-				Name:  lb.cookieName,
-				Value: "1",
+				Name:  persistence.CookieName,
+				Value: persistence.sign("bar"),
 			},
 			services: []*Service{
 				{
+					Name:   "foo",
 					Health: health.Always(true),
 					Router: NewRedirect(url.URL{Scheme: "http", Host: "wrong.example.com"}),
 				},
 				{
+					Name:   "bar",
 					Health: health.Always(true),
 					Router: NewRedirect(url.URL{Scheme: "https", Host: "example.com"}),
 				},
 			},
 			expectedURL: "https://example.com",
 		},
+		"tampered cookie": {
+			cookie: &http.Cookie{
+				Name:  persistence.CookieName,
+				Value: forged.sign("bar"),
+			},
+			services: []*Service{
+				{
+					Name:   "foo",
+					Health: health.Always(true),
+					Router: NewRedirect(url.URL{Scheme: "http", Host: "foo.example.com"}),
+				},
+				{
+					Name:   "bar",
+					Health: health.Always(true),
+					Router: NewRedirect(url.URL{Scheme: "http", Host: "bar.example.com"}),
+				},
+			},
+			expectedURL: "http://foo.example.com",
+		},
+		"raw index cookie": {
+			cookie: &http.Cookie{
+				Name:  persistence.CookieName,
+				Value: "1",
+			},
+			services: []*Service{
+				{
+					Name:   "foo",
+					Health: health.Always(true),
+					Router: NewRedirect(url.URL{Scheme: "http", Host: "foo.example.com"}),
+				},
+				{
+					Name:   "bar",
+					Health: health.Always(true),
+					Router: NewRedirect(url.URL{Scheme: "http", Host: "bar.example.com"}),
+				},
+			},
+			expectedURL: "http://foo.example.com",
+		},
+		"cookie to unhealthy service with no healthy fallback": {
+			cookie: &http.Cookie{
+				Name:  persistence.CookieName,
+				Value: persistence.sign("foo"),
+			},
+			services: []*Service{
+				{
+					Name:   "foo",
+					Health: health.Always(false),
+					Router: NewRedirect(url.URL{Scheme: "http", Host: "example.com"}),
+				},
+			},
+			expectedErr: errNoAvailableService,
+		},
 	}
 
 	for name, test := range tests {
@@ -93,6 +153,67 @@ func TestLoadBalancerPersistentService(t *testing.T) {
 	}
 }
 
+func TestLoadBalancerPersistentCookie(t *testing.T) {
+	persistence := &Persistence{
+		CookieName: "session",
+		Key:        []byte("secret"),
+		Secure:     true,
+		SameSite:   http.SameSiteStrictMode,
+		MaxAge:     time.Hour,
+	}
+	lb := NewLoadBalancer("host", &Failover{}, []*Service{
+		{
+			Name:   "foo",
+			Health: health.Always(true),
+			Router: NewRedirect(url.URL{Scheme: "http", Host: "foo.example.com"}),
+		},
+	}, LoadBalancerOptions{Persistence: persistence})
+
+	w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	if _, err := lb.Route(w, r); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	cookies := res.Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected 1 cookie, got %d", len(cookies))
+	}
+	cookie := cookies[0]
+	if cookie.Name != "session" || cookie.Path != "/" || !cookie.Secure || !cookie.HttpOnly ||
+		cookie.SameSite != http.SameSiteStrictMode || cookie.MaxAge != 3600 {
+		t.Errorf("unexpected cookie attributes %+v", cookie)
+	}
+	if name, err := persistence.verify(cookie.Value); err != nil || name != "foo" {
+		t.Errorf("expected cookie to identify foo, got %s (error %v)", name, err)
+	}
+}
+
+func TestLoadBalancerMembers(t *testing.T) {
+	services := []*Service{
+		{Name: "foo", Health: health.Always(true)},
+		{Name: "bar", Health: health.Always(false)},
+	}
+	lb := NewLoadBalancer("host", &Failover{}, services, LoadBalancerOptions{
+		OutlierDetection: &OutlierDetection{},
+	})
+
+	members := lb.Members()
+	if len(members) != len(services) {
+		t.Fatalf("expected %d members, got %d", len(services), len(members))
+	}
+	for i, m := range members {
+		if _, ok := m.(drainable).Checker.(*member); !ok {
+			t.Errorf("expected member %d to include the load balancer's passive health checking", i)
+		}
+		if m.Up() != services[i].Health.Up() {
+			t.Errorf("expected member %d to be up %v, got %v", i, services[i].Health.Up(), m.Up())
+		}
+	}
+}
+
 func TestLoadBalancerRoute(t *testing.T) {
 	tests := map[string]struct {
 		persistent  bool
@@ -104,6 +225,15 @@ func TestLoadBalancerRoute(t *testing.T) {
 			services:    []*Service{},
 			expectedErr: errNoServices,
 		},
+		"no healthy services": {
+			services: []*Service{
+				{
+					Health: health.Always(false),
+					Router: NewRedirect(url.URL{Scheme: "http", Host: "foo.example.com"}),
+				},
+			},
+			expectedErr: errNoAvailableService,
+		},
 		"with services": {
 			services: []*Service{
 				{
@@ -121,7 +251,7 @@ func TestLoadBalancerRoute(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			lb := NewLoadBalancer("host", &Failover{}, false, test.services)
+			lb := NewLoadBalancer("host", &Failover{}, test.services, LoadBalancerOptions{})
 
 			w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
 
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+// slowStartMinWeight is the weight of a service that has just recovered.
+const slowStartMinWeight = 0.1
+
+// member is a health checker for a service within a particular load balancer.
+// It wraps the service's own health checker with the load balancer's passive health checking
+// and reports the service's effective weight for selection.
+type member struct {
+	health.Checker
+
+	outlier    *outlier
+	slowStart  time.Duration
+	load       *load
+	loadHeader string
+	now        func() time.Time
+
+	mu      sync.Mutex
+	up      bool
+	upSince time.Time
+}
+
+// newMember creates a member for a service. The service is assumed to have been up for a long time,
+// so that services that are healthy from the start are not slow started.
+func newMember(service *Service, options LoadBalancerOptions) *member {
+	m := &member{
+		Checker:   service.Health,
+		slowStart: options.SlowStart,
+		now:       time.Now,
+		up:        true,
+	}
+	if options.OutlierDetection != nil {
+		m.outlier = newOutlier(service.Name, options.OutlierDetection)
+	}
+	if options.LoadFeedback != nil {
+		m.load = &load{damping: options.LoadFeedback.Damping}
+		m.loadHeader = options.LoadFeedback.Header
+	}
+	return m
+}
+
+// Up returns whether the service is healthy and not ejected.
+// A service that comes back up is slow started from this moment on.
+func (m *member) Up() bool {
+	up := m.Checker.Up() && (m.outlier == nil || !m.outlier.ejected())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if up && !m.up {
+		m.upSince = m.now()
+	}
+	m.up = up
+	return up
+}
+
+// Weight returns the effective weight of the service between 0 and 1.
+// During slow start, the weight grows linearly from slowStartMinWeight to 1.
+// With load feedback, the weight is further reduced by the service's load.
+func (m *member) Weight() float64 {
+	w := m.slowStartWeight()
+	if m.load != nil {
+		if reporter, ok := m.Checker.(loadReporter); ok {
+			if reported, ok := reporter.Load(); ok {
+				m.load.observe(reported, m.now())
+			}
+		}
+		w *= m.load.weight()
+	}
+	return w
+}
+
+func (m *member) slowStartWeight() float64 {
+	if m.slowStart <= 0 {
+		return 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elapsed := m.now().Sub(m.upSince)
+	if elapsed >= m.slowStart {
+		return 1
+	}
+	return max(slowStartMinWeight, float64(elapsed)/float64(m.slowStart))
+}
+
+// inheritMembers carries the ejections and slow start of the members of a previous load balancer
+// over to the members with the same name.
+func (l *LoadBalancer) inheritMembers(previous *LoadBalancer) {
+	for _, service := range l.services {
+		m, ok := service.Health.(*member)
+		if !ok {
+			continue
+		}
+		prev := previous.serviceByName(service.Name)
+		if prev == nil {
+			continue
+		}
+		if pm, ok := prev.Health.(*member); ok && pm != m {
+			m.inherit(pm)
+		}
+	}
+}
+
+// inherit copies the slow start and the ejections of previous.
+func (m *member) inherit(previous *member) {
+	previous.mu.Lock()
+	up, upSince := previous.up, previous.upSince
+	previous.mu.Unlock()
+	m.mu.Lock()
+	m.up, m.upSince = up, upSince
+	m.mu.Unlock()
+	if m.outlier != nil && previous.outlier != nil {
+		m.outlier.inherit(previous.outlier)
+	}
+}
+
+// membersOf returns copies of the services whose health checkers are wrapped in members.
+// The services are copied since the same service may be part of multiple load balancers.
+func membersOf(services []*Service, options LoadBalancerOptions) []*Service {
+	views := make([]*Service, len(services))
+	for i, service := range services {
+		view := *service
+		view.Health = newMember(service, options)
+		views[i] = &view
+	}
+	return views
+}
+
+// reportAttempt records the outcome of a proxied attempt if the service has outlier detection,
+// and the load reported in its response if the load balancer has load feedback.
+func reportAttempt(service *Service, req *http.Request, res *http.Response, err error) {
+	m, ok := service.Health.(*member)
+	if !ok {
+		return
+	}
+	if m.outlier != nil {
+		m.outlier.report(failedAttempt(req, res, err))
+	}
+	if m.load != nil {
+		m.load.observeResponse(res, m.loadHeader, m.now())
+	}
+}
+
+// weigher is implemented by health checkers that report an effective weight for selection.
+type weigher interface {
+	Weight() float64
+}
+
+// weight returns the effective weight of a service. Services without a weight have a weight of 1.
+func weight(service *Service) float64 {
+	if w, ok := service.Health.(weigher); ok {
+		return w.Weight()
+	}
+	return 1
+}
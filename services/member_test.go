@@ -0,0 +1,101 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+// toggleHealth is a health checker whose health can be changed by tests.
+type toggleHealth struct {
+	health.Always
+	up bool
+}
+
+func (t *toggleHealth) Up() bool {
+	return t.up
+}
+
+func TestMemberUp(t *testing.T) {
+	tests := map[string]struct {
+		health   health.Checker
+		ejected  bool
+		expected bool
+	}{
+		"up":                  {health: health.Always(true), expected: true},
+		"failed health check": {health: health.Always(false), expected: false},
+		"ejected":             {health: health.Always(true), ejected: true, expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			detection := &OutlierDetection{ConsecutiveFailures: 1, BaseEjectionTime: time.Hour}
+			detection.setDefaults()
+			m := newMember(&Service{Name: "foo", Health: test.health}, LoadBalancerOptions{OutlierDetection: detection})
+			if test.ejected {
+				m.outlier.report(true)
+			}
+			if actual := m.Up(); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMemberSlowStart(t *testing.T) {
+	now := time.Unix(0, 0)
+	checker := &toggleHealth{up: true}
+	m := newMember(&Service{Name: "foo", Health: checker}, LoadBalancerOptions{SlowStart: 10 * time.Second})
+	m.now = func() time.Time { return now }
+
+	// A service that is healthy from the start is not slow started.
+	if !m.Up() || m.Weight() != 1 {
+		t.Fatalf("expected initially healthy service to have full weight, got %v", m.Weight())
+	}
+
+	checker.up = false
+	if m.Up() {
+		t.Fatalf("expected service to be down")
+	}
+	now = now.Add(time.Minute)
+	checker.up = true
+	if !m.Up() {
+		t.Fatalf("expected service to be up")
+	}
+
+	recovered := now
+	tests := []struct {
+		elapsed  time.Duration
+		expected float64
+	}{
+		{0, slowStartMinWeight},
+		{time.Second, slowStartMinWeight},
+		{2 * time.Second, 0.2},
+		{5 * time.Second, 0.5},
+		{9 * time.Second, 0.9},
+		{10 * time.Second, 1},
+		{time.Hour, 1},
+	}
+	for _, test := range tests {
+		now = recovered.Add(test.elapsed)
+		if actual := m.Weight(); actual != test.expected {
+			t.Errorf("expected weight %v after %s, got %v", test.expected, test.elapsed, actual)
+		}
+	}
+}
+
+func TestMembersOf(t *testing.T) {
+	services := []*Service{{Name: "foo", Health: health.Always(true)}}
+	members := membersOf(services, LoadBalancerOptions{SlowStart: time.Second})
+
+	if members[0] == services[0] {
+		t.Fatalf("expected service to be copied")
+	}
+	if _, ok := members[0].Health.(*member); !ok {
+		t.Errorf("expected member health, got %T", members[0].Health)
+	}
+	if _, ok := services[0].Health.(health.Always); !ok {
+		t.Errorf("expected original service to be unchanged, got %T", services[0].Health)
+	}
+}
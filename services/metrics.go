@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/plamorg/voltproxy/logging"
+	"github.com/plamorg/voltproxy/metrics"
+	"github.com/plamorg/voltproxy/tracing"
+)
+
+// Routing error types.
+const (
+	routingErrorUnknownHost        = "unknown_host"
+	routingErrorTLSNotSupported    = "tls_not_supported"
+	routingErrorNoAvailableService = "no_available_service"
+	routingErrorQueueFull          = "queue_full"
+	routingErrorQueueTimeout       = "queue_timeout"
+	routingErrorNoContainer        = "no_container"
+	routingErrorNoNetwork          = "no_network"
+	routingErrorOther              = "other"
+)
+
+// otherMethod labels the metrics of requests with non-standard methods, which clients can choose freely.
+const otherMethod = "OTHER"
+
+var (
+	requestsTotal = metrics.Default.NewCounter("voltproxy_requests_total",
+		"Number of requests by service, method and status code.", "service", "method", "code")
+	requestDuration = metrics.Default.NewHistogram("voltproxy_request_duration_seconds",
+		"Time taken to respond to requests by service and method.", metrics.DefaultBuckets, "service", "method")
+	requestsInFlight = metrics.Default.NewGauge("voltproxy_requests_in_flight",
+		"Number of requests being handled by service.", "service")
+	requestBytes = metrics.Default.NewCounter("voltproxy_request_bytes_total",
+		"Number of bytes read from request bodies by service.", "service")
+	responseBytes = metrics.Default.NewCounter("voltproxy_response_bytes_total",
+		"Number of bytes written to response bodies by service.", "service")
+	routingErrors = metrics.Default.NewCounter("voltproxy_routing_errors_total",
+		"Number of requests that could not be routed by service and type of error.", "service", "type")
+)
+
+// methodLabel returns the label of a request method, grouping non-standard methods together.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return otherMethod
+	}
+}
+
+// routingErrorType returns the type of an error returned by a router.
+func routingErrorType(err error) string {
+	switch {
+	case errors.Is(err, errQueueFull):
+		return routingErrorQueueFull
+	case errors.Is(err, errQueueTimeout):
+		return routingErrorQueueTimeout
+	case errors.Is(err, errNoAvailableService):
+		return routingErrorNoAvailableService
+	case errors.Is(err, errNoContainerFound):
+		return routingErrorNoContainer
+	case errors.Is(err, errNoNetworkFound):
+		return routingErrorNoNetwork
+	default:
+		return routingErrorOther
+	}
+}
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// responseRecorder records the status code and the number of bytes of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	// Informational responses may precede the final status code.
+	if w.status == 0 && (status >= http.StatusOK || status == http.StatusSwitchingProtocols) {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter, so that http.ResponseController can flush and hijack it.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// measurement measures a request to a service for its metrics and the access log.
+type measurement struct {
+	start    time.Time
+	service  string
+	method   string
+	recorder *responseRecorder
+	body     *countingBody
+	// entry holds the fields of the request, which are captured before it is modified by the proxy.
+	entry logging.AccessEntry
+	// backend is the URL the request was routed to, if any.
+	backend string
+	// sel is the selection of the load balancer the request was routed through, if any,
+	// which names the service that finally handled the request once it has been retried or hedged.
+	sel *selection
+	// span is the server span of the request, if it is traced.
+	span *tracing.Span
+}
+
+// measureRequest starts measuring a request to a service, counting the bytes read from its body.
+// The request must then be handled with the response writer of the measurement.
+func measureRequest(service string, w http.ResponseWriter, r *http.Request) *measurement {
+	m := &measurement{
+		start:    time.Now(),
+		service:  service,
+		method:   methodLabel(r.Method),
+		recorder: &responseRecorder{ResponseWriter: w},
+		body:     &countingBody{ReadCloser: r.Body},
+		entry:    accessEntry(r),
+	}
+	if r.Body != nil {
+		r.Body = m.body
+	}
+	requestsInFlight.Inc(service)
+	return m
+}
+
+// done records the metrics of the request once it has been handled, and writes it to the access log.
+func (m *measurement) done(r *http.Request) {
+	duration := time.Since(m.start)
+	status := m.recorder.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	requestsInFlight.Dec(m.service)
+	requestsTotal.Inc(m.service, m.method, strconv.Itoa(status))
+	requestDuration.Observe(duration.Seconds(), m.service, m.method)
+	requestBytes.Add(float64(m.body.n.Load()), m.service)
+	responseBytes.Add(float64(m.recorder.written), m.service)
+	m.endSpan(status)
+
+	entry := m.entry
+	entry.Service, entry.Backend = m.service, m.backend
+	if m.sel != nil && m.sel.route != nil {
+		entry.Backend = m.sel.route.String()
+	}
+	entry.Status, entry.Bytes, entry.Duration = status, m.recorder.written, duration
+	logAccess(r, entry)
+}
+
+// logAccess writes the entry of a request to the access log, if any.
+func logAccess(r *http.Request, entry logging.AccessEntry) {
+	accessLog := logging.Access()
+	if accessLog == nil {
+		return
+	}
+	if accessLog.UserHeader != "" {
+		entry.User = r.Header.Get(accessLog.UserHeader)
+	}
+	accessLog.Log(entry)
+}
+
+// accessEntry returns an access log entry with the fields of a request.
+func accessEntry(r *http.Request) logging.AccessEntry {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	return logging.AccessEntry{
+		Time:      time.Now(),
+		ClientIP:  clientIP,
+		Method:    r.Method,
+		URI:       r.RequestURI,
+		Proto:     r.Proto,
+		Host:      r.Host,
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+		RequestID: r.Header.Get(logging.RequestIDHeader),
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/plamorg/voltproxy/logging"
+	"github.com/plamorg/voltproxy/metrics"
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	var b strings.Builder
+	if _, err := metrics.Default.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.ToUpper(string(body))))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := Handler(map[string]*Service{
+		"metrics.example.com": {Name: "metrics", Router: NewRedirect(*serverURL)},
+		"broken.example.com":  {Name: "broken", Router: badRouter{}},
+	})
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "http://metrics.example.com", strings.NewReader("hello")),
+		httptest.NewRequest("PURGE", "http://metrics.example.com", nil),
+		httptest.NewRequest(http.MethodGet, "http://broken.example.com", nil),
+		httptest.NewRequest(http.MethodGet, "http://unknown.example.com", nil),
+	}
+	for _, r := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	output := scrape(t)
+	for _, expected := range []string{
+		`voltproxy_requests_total{service="metrics",method="POST",code="201"} 1`,
+		`voltproxy_requests_total{service="metrics",method="OTHER",code="201"} 1`,
+		`voltproxy_requests_total{service="broken",method="GET",code="500"} 1`,
+		`voltproxy_request_duration_seconds_count{service="metrics",method="POST"} 1`,
+		`voltproxy_requests_in_flight{service="metrics"} 0`,
+		`voltproxy_request_bytes_total{service="metrics"} 5`,
+		`voltproxy_response_bytes_total{service="metrics"} 5`,
+		`voltproxy_routing_errors_total{service="broken",type="other"} 1`,
+		`voltproxy_routing_errors_total{service="",type="unknown_host"}`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected metrics to contain %s, got %s", expected, output)
+		}
+	}
+}
+
+func TestRoutingErrorType(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected string
+	}{
+		"queue full":           {err: errQueueFull, expected: routingErrorQueueFull},
+		"queue timeout":        {err: errQueueTimeout, expected: routingErrorQueueTimeout},
+		"no available service": {err: errNoAvailableService, expected: routingErrorNoAvailableService},
+		"no container":         {err: fmt.Errorf("%w: foo", errNoContainerFound), expected: routingErrorNoContainer},
+		"no network":           {err: errNoNetworkFound, expected: routingErrorNoNetwork},
+		"other":                {err: fmt.Errorf("other"), expected: routingErrorOther},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := routingErrorType(test.err); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandlerAccessLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	logConfig := logging.Config{Access: &logging.AccessConfig{
+		Format:     logging.FormatTemplate,
+		Template:   "{{.ClientIP}} {{.User}} {{.Method}} {{.Host}} {{.Service}} {{.Backend}} {{.Status}} {{.Bytes}}",
+		Path:       path,
+		UserHeader: "X-User",
+	}}
+	if err := logConfig.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer (&logging.Config{}).Initialize()
+
+	handler := Handler(map[string]*Service{
+		"access.example.com": {Name: "access", Router: NewRedirect(*serverURL)},
+	})
+	r := httptest.NewRequest(http.MethodGet, "http://access.example.com/foo", nil)
+	r.Header.Set("X-User", "alice")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	// Requests to unknown hosts are logged without a service.
+	r = httptest.NewRequest(http.MethodGet, "http://unknown.example.com/foo", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("192.0.2.1 alice GET access.example.com access %s 200 5\n"+
+		"192.0.2.1  GET unknown.example.com   404 0\n", server.URL)
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
+
+func TestHandlerAccessLogRetriedBackend(t *testing.T) {
+	down, up := closedServerURL(t), statusServerURL(t, http.StatusOK, 0)
+	lb := NewLoadBalancer("retry.example.com", &Failover{}, []*Service{
+		{Name: "down", Health: health.Always(true), Router: NewRedirect(down)},
+		{Name: "up", Health: health.Always(true), Router: NewRedirect(up)},
+	}, LoadBalancerOptions{Retry: &RetryPolicy{Attempts: 2, DialErrors: true}})
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	logConfig := logging.Config{Access: &logging.AccessConfig{
+		Format:   logging.FormatTemplate,
+		Template: "{{.Service}} {{.Backend}} {{.Status}}",
+		Path:     path,
+	}}
+	if err := logConfig.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer (&logging.Config{}).Initialize()
+
+	handler := Handler(map[string]*Service{"retry.example.com": {Name: "lb", Router: lb}})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://retry.example.com", nil))
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backend is the service that served the response after the first one failed to connect.
+	expected := fmt.Sprintf("lb %s 200\n", up.String())
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOutlierConsecutiveFailures = 5
+	defaultOutlierBaseEjectionTime    = 30 * time.Second
+	defaultOutlierMaxEjectionTime     = 5 * time.Minute
+)
+
+// OutlierDetection configures passive health checking for a LoadBalancer.
+// The responses of proxied requests are tracked per service, and a service that keeps failing
+// is temporarily ejected from selection. Every consecutive ejection doubles the ejection time.
+type OutlierDetection struct {
+	// ConsecutiveFailures is the number of consecutive 5xx responses or connection errors
+	// after which a service is ejected.
+	ConsecutiveFailures int
+	// BaseEjectionTime is how long a service is ejected for the first time.
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime caps the ejection time.
+	MaxEjectionTime time.Duration
+}
+
+func (o *OutlierDetection) setDefaults() {
+	if o.ConsecutiveFailures <= 0 {
+		o.ConsecutiveFailures = defaultOutlierConsecutiveFailures
+	}
+	if o.BaseEjectionTime <= 0 {
+		o.BaseEjectionTime = defaultOutlierBaseEjectionTime
+	}
+	if o.MaxEjectionTime < o.BaseEjectionTime {
+		o.MaxEjectionTime = max(defaultOutlierMaxEjectionTime, o.BaseEjectionTime)
+	}
+}
+
+// outlier tracks the proxied requests of a service and ejects it when they keep failing.
+type outlier struct {
+	name      string
+	detection *OutlierDetection
+	now       func() time.Time
+
+	mu           sync.Mutex
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+	ejectionTime time.Duration
+}
+
+func newOutlier(name string, detection *OutlierDetection) *outlier {
+	return &outlier{
+		name:      name,
+		detection: detection,
+		now:       time.Now,
+	}
+}
+
+func (o *outlier) ejected() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.now().Before(o.ejectedUntil)
+}
+
+// inherit copies the failures and ejections of previous.
+func (o *outlier) inherit(previous *outlier) {
+	previous.mu.Lock()
+	failures, ejections := previous.failures, previous.ejections
+	ejectedUntil, ejectionTime := previous.ejectedUntil, previous.ejectionTime
+	previous.mu.Unlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.failures, o.ejections = failures, ejections
+	o.ejectedUntil, o.ejectionTime = ejectedUntil, ejectionTime
+}
+
+// report records the outcome of a proxied request.
+func (o *outlier) report(failed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := o.now()
+	if !failed {
+		o.failures = 0
+		// Forget previous ejections once the service has stayed in for as long as it was last ejected.
+		if o.ejections > 0 && now.After(o.ejectedUntil.Add(o.ejectionTime)) {
+			o.ejections = 0
+		}
+		return
+	}
+
+	if now.Before(o.ejectedUntil) {
+		return
+	}
+	o.failures++
+	if o.failures < o.detection.ConsecutiveFailures {
+		return
+	}
+
+	o.failures = 0
+	o.ejections++
+	o.ejectionTime = o.detection.BaseEjectionTime
+	for i := 1; i < o.ejections && o.ejectionTime < o.detection.MaxEjectionTime; i++ {
+		o.ejectionTime *= 2
+	}
+	o.ejectionTime = min(o.ejectionTime, o.detection.MaxEjectionTime)
+	o.ejectedUntil = now.Add(o.ejectionTime)
+	slog.Warn("Ejecting outlier service",
+		slog.String("service", o.name),
+		slog.Int("ejections", o.ejections),
+		slog.Duration("ejectionTime", o.ejectionTime))
+}
+
+// failedAttempt returns whether a proxied attempt counts as a failure of the service.
+// Requests cancelled by the client are not the service's fault and are not counted.
+func failedAttempt(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(req.Context().Err(), context.Canceled)
+	}
+	return res.StatusCode >= http.StatusInternalServerError
+}
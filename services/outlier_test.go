@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func TestOutlierDetectionDefaults(t *testing.T) {
+	detection := &OutlierDetection{}
+	detection.setDefaults()
+
+	expected := OutlierDetection{
+		ConsecutiveFailures: defaultOutlierConsecutiveFailures,
+		BaseEjectionTime:    defaultOutlierBaseEjectionTime,
+		MaxEjectionTime:     defaultOutlierMaxEjectionTime,
+	}
+	if *detection != expected {
+		t.Errorf("expected %+v, got %+v", expected, *detection)
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	now := time.Unix(0, 0)
+	o := newOutlier("foo", &OutlierDetection{
+		ConsecutiveFailures: 2,
+		BaseEjectionTime:    10 * time.Second,
+		MaxEjectionTime:     30 * time.Second,
+	})
+	o.now = func() time.Time { return now }
+
+	// A success in between failures resets the consecutive failure count.
+	o.report(true)
+	o.report(false)
+	o.report(true)
+	if o.ejected() {
+		t.Fatalf("expected service to be up")
+	}
+	o.report(false)
+
+	for i, ejectionTime := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second} {
+		o.report(true)
+		o.report(true)
+		if !o.ejected() {
+			t.Fatalf("ejection %d: expected service to be ejected", i)
+		}
+
+		// Failures while ejected are ignored.
+		o.report(true)
+
+		now = now.Add(ejectionTime - time.Nanosecond)
+		if !o.ejected() {
+			t.Fatalf("ejection %d: expected service to be ejected for %s", i, ejectionTime)
+		}
+		now = now.Add(time.Nanosecond)
+		if o.ejected() {
+			t.Fatalf("ejection %d: expected service to be up after %s", i, ejectionTime)
+		}
+	}
+
+	// Ejections are forgotten once the service has stayed in for as long as it was last ejected.
+	now = now.Add(30*time.Second + time.Nanosecond)
+	o.report(false)
+	o.report(true)
+	o.report(true)
+	now = now.Add(10 * time.Second)
+	if o.ejected() {
+		t.Fatalf("expected ejection time to be reset")
+	}
+}
+
+func TestFailedAttempt(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := map[string]struct {
+		ctx      context.Context
+		res      *http.Response
+		err      error
+		expected bool
+	}{
+		"success":          {ctx: context.Background(), res: &http.Response{StatusCode: 200}, expected: false},
+		"client error":     {ctx: context.Background(), res: &http.Response{StatusCode: 404}, expected: false},
+		"server error":     {ctx: context.Background(), res: &http.Response{StatusCode: 502}, expected: true},
+		"connection error": {ctx: context.Background(), err: fmt.Errorf("connection refused"), expected: true},
+		"client cancelled": {ctx: cancelled, err: context.Canceled, expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(test.ctx)
+			if actual := failedAttempt(r, test.res, test.err); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerOutlierDetection(t *testing.T) {
+	pool := []*Service{
+		{
+			Name:   "failing",
+			Health: health.Always(true),
+			Router: NewRedirect(statusServerURL(t, http.StatusInternalServerError, 0)),
+		},
+		{
+			Name:   "ok",
+			Health: health.Always(true),
+			Router: NewRedirect(statusServerURL(t, http.StatusOK, 0)),
+		},
+	}
+	lb := NewLoadBalancer("example.com", &RoundRobin{}, pool, LoadBalancerOptions{
+		OutlierDetection: &OutlierDetection{ConsecutiveFailures: 2, BaseEjectionTime: time.Hour},
+	})
+	services := map[string]*Service{"example.com": {Router: lb}}
+
+	var codes []int
+	for i := 0; i < 8; i++ {
+		w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		Handler(services).ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+
+	// The failing service is ejected after its second failure, after which only the healthy service is used.
+	expected := []int{500, 200, 500, 200, 200, 200, 200, 200}
+	if fmt.Sprint(codes) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, codes)
+	}
+	if pool[0].Health.Up() != true {
+		t.Errorf("expected ejection to not affect the service outside of the load balancer")
+	}
+}
+
+func TestLoadBalancerOutlierDetectionAllEjected(t *testing.T) {
+	remote := closedServerURL(t)
+	lb := NewLoadBalancer("example.com", &RoundRobin{}, []*Service{
+		{Name: "down", Health: health.Always(true), Router: NewRedirect(remote)},
+	}, LoadBalancerOptions{
+		OutlierDetection: &OutlierDetection{ConsecutiveFailures: 1, BaseEjectionTime: time.Hour},
+	})
+	services := map[string]*Service{"example.com": {Router: lb}}
+
+	expected := []int{http.StatusBadGateway, http.StatusServiceUnavailable}
+	for _, code := range expected {
+		w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		Handler(services).ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("expected code %d, got %d", code, w.Code)
+		}
+	}
+
+	if _, err := lb.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)); err == nil {
+		t.Errorf("expected error routing to ejected service")
+	}
+}
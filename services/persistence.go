@@ -0,0 +1,94 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errInvalidCookie = fmt.Errorf("invalid persistence cookie")
+
+const (
+	defaultPersistenceCookiePath = "/"
+	persistenceSeparator         = "."
+)
+
+// Persistence configures cookie-based session persistence for a LoadBalancer.
+// The cookie stores the name of the chosen service signed with an HMAC so that
+// clients cannot pick a service by editing the cookie.
+type Persistence struct {
+	// CookieName is the name of the cookie. If empty, a name is derived from the load balancer's host.
+	CookieName string
+	// Key is the HMAC key used to sign cookies.
+	Key []byte
+
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+	// MaxAge is the lifetime of the cookie. A zero MaxAge creates a session cookie.
+	MaxAge time.Duration
+}
+
+func (p *Persistence) setDefaults(host string) {
+	if p.CookieName == "" {
+		p.CookieName = generateCookieName(host)
+	}
+	if p.Path == "" {
+		p.Path = defaultPersistenceCookiePath
+	}
+}
+
+func (p *Persistence) mac(name string) []byte {
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(p.CookieName))
+	mac.Write([]byte(persistenceSeparator))
+	mac.Write([]byte(name))
+	return mac.Sum(nil)
+}
+
+// sign returns a cookie value that identifies the service with the given name.
+func (p *Persistence) sign(name string) string {
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString([]byte(name)) + persistenceSeparator + encoding.EncodeToString(p.mac(name))
+}
+
+// verify returns the service name stored in a cookie value created by sign.
+// An error is returned if the value is malformed or its signature does not match.
+func (p *Persistence) verify(value string) (string, error) {
+	encoding := base64.RawURLEncoding
+	encodedName, encodedMAC, ok := strings.Cut(value, persistenceSeparator)
+	if !ok {
+		return "", errInvalidCookie
+	}
+	name, err := encoding.DecodeString(encodedName)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidCookie, err)
+	}
+	mac, err := encoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidCookie, err)
+	}
+	if !hmac.Equal(mac, p.mac(string(name))) {
+		return "", fmt.Errorf("%w: signature mismatch", errInvalidCookie)
+	}
+	return string(name), nil
+}
+
+// cookie returns the persistence cookie identifying the service with the given name.
+func (p *Persistence) cookie(name string) *http.Cookie {
+	return &http.Cookie{
+		Name:     p.CookieName,
+		Value:    p.sign(name),
+		Path:     p.Path,
+		Domain:   p.Domain,
+		MaxAge:   int(p.MaxAge.Seconds()),
+		Secure:   p.Secure,
+		HttpOnly: true,
+		SameSite: p.SameSite,
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPersistenceSignVerify(t *testing.T) {
+	p := &Persistence{CookieName: "cookie", Key: []byte("secret")}
+
+	for _, name := range []string{"foo", "", "name.with.dots", "ünïcödé"} {
+		actual, err := p.verify(p.sign(name))
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if actual != name {
+			t.Errorf("expected %s, got %s", name, actual)
+		}
+	}
+}
+
+func TestPersistenceVerifyError(t *testing.T) {
+	p := &Persistence{CookieName: "cookie", Key: []byte("secret")}
+	tests := map[string]string{
+		"empty":              "",
+		"raw index":          "0",
+		"bad name encoding":  "!!!." + p.sign("foo"),
+		"bad mac encoding":   "Zm9v.!!!",
+		"wrong key":          (&Persistence{CookieName: "cookie", Key: []byte("other")}).sign("foo"),
+		"wrong cookie name":  (&Persistence{CookieName: "other", Key: []byte("secret")}).sign("foo"),
+		"swapped name":       "YmFy" + p.sign("foo")[len("Zm9v"):],
+		"truncated":          p.sign("foo")[:10],
+		"missing signature":  "Zm9v",
+		"trailing separator": "Zm9v.",
+	}
+
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := p.verify(value); !errors.Is(err, errInvalidCookie) {
+				t.Errorf("expected %v, got %v", errInvalidCookie, err)
+			}
+		})
+	}
+}
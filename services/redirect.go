@@ -17,5 +17,10 @@ func NewRedirect(remote url.URL) *Redirect {
 
 // Route redirects to the remote URL.
 func (r *Redirect) Route(_ http.ResponseWriter, _ *http.Request) (*url.URL, error) {
+	return r.Endpoint()
+}
+
+// Endpoint returns the remote URL, which is checked by health checks.
+func (r *Redirect) Endpoint() (*url.URL, error) {
 	return &r.remote, nil
 }
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Registry holds the services to proxy by host.
+// The services can be replaced while requests are being handled, e.g. when the configuration is reloaded.
+type Registry struct {
+	services atomic.Pointer[map[string]*Service]
+}
+
+// NewRegistry creates a new Registry of the given services.
+func NewRegistry(services map[string]*Service) *Registry {
+	r := &Registry{}
+	r.services.Store(&services)
+	return r
+}
+
+// Services returns the current services by host.
+func (r *Registry) Services() map[string]*Service {
+	return *r.services.Load()
+}
+
+// Replace replaces the services and returns the previous ones.
+// Requests that are being handled keep using the previous services.
+// Canary rollouts that the new services no longer have are forgotten.
+func (r *Registry) Replace(services map[string]*Service) map[string]*Service {
+	previous := *r.services.Swap(&services)
+	pruneRollouts(services)
+	return previous
+}
+
+// Handler returns a http.Handler that proxies requests to the current services, redirecting to TLS if applicable.
+func (r *Registry) Handler() http.Handler {
+	return handler(r.Services, false)
+}
+
+// TLSHandler returns a http.Handler that proxies requests to the current services with TLS enabled.
+func (r *Registry) TLSHandler() http.Handler {
+	return handler(r.Services, true)
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryReplace(t *testing.T) {
+	registry := NewRegistry(map[string]*Service{
+		"foo.example.com": {Router: NewRedirect(statusServerURL(t, http.StatusAccepted, 0))},
+	})
+	handler := registry.Handler()
+
+	request := func() int {
+		w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://foo.example.com", nil)
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if actual := request(); actual != http.StatusAccepted {
+		t.Errorf("expected status code %d, got %d", http.StatusAccepted, actual)
+	}
+
+	previous := registry.Replace(map[string]*Service{})
+	if _, ok := previous["foo.example.com"]; !ok {
+		t.Errorf("expected previous services to be returned")
+	}
+	if actual := request(); actual != http.StatusNotFound {
+		t.Errorf("expected status code %d, got %d", http.StatusNotFound, actual)
+	}
+}
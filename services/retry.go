@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var errAttemptTimeout = fmt.Errorf("attempt timed out")
+
+const attemptsHeader = "X-Voltproxy-Attempts"
+
+// defaultRetryMethods are the idempotent methods that are retried if no methods are specified.
+var defaultRetryMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodTrace,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// RetryPolicy describes when a LoadBalancer retries a failed request on another service.
+// Each retry is sent to a service that has not been tried yet.
+// Requests with a body are never retried since the body cannot be replayed.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+	// DialErrors specifies whether to retry if a connection to the service could not be established.
+	DialErrors bool
+	// Timeouts specifies whether to retry if the service did not respond in time.
+	Timeouts bool
+	// StatusCodes are the response status codes that are retried.
+	StatusCodes []int
+	// Methods are the request methods that are retried. If nil, only idempotent methods are retried.
+	Methods []string
+	// Backoff is the delay before the first retry. The delay doubles on every subsequent retry.
+	Backoff time.Duration
+	// Timeout is how long to wait for the response headers of each attempt. Zero means no timeout.
+	Timeout time.Duration
+}
+
+func (p *RetryPolicy) setDefaults() {
+	if p.Attempts < 1 {
+		p.Attempts = 1
+	}
+	if p.Methods == nil {
+		p.Methods = defaultRetryMethods
+	}
+}
+
+// retryableRequest returns whether the request can be retried at all.
+func (p *RetryPolicy) retryableRequest(r *http.Request) bool {
+	return slices.Contains(p.Methods, r.Method) && (r.Body == nil || r.Body == http.NoBody)
+}
+
+// retryableResult returns whether an attempt that returned res and err should be retried.
+func (p *RetryPolicy) retryableResult(res *http.Response, err error) bool {
+	if err == nil {
+		return slices.Contains(p.StatusCodes, res.StatusCode)
+	}
+	var netErr net.Error
+	timeout := errors.Is(err, errAttemptTimeout) || (errors.As(err, &netErr) && netErr.Timeout())
+	if timeout {
+		return p.Timeouts
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return p.DialErrors
+	}
+	return false
+}
+
+// backoff returns the delay before the given retry, starting at 1.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	return p.Backoff << (retry - 1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cancelBody cancels the context of an attempt once its response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelCauseFunc
+}
+
+func (c *cancelBody) Close() error {
+	defer c.cancel(nil)
+	return c.ReadCloser.Close()
+}
+
+// roundTripAttempt sends a single attempt, giving up if the response headers
+// do not arrive within the policy's timeout.
+func roundTripAttempt(transport http.RoundTripper, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout == 0 {
+		return transport.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(timeout, func() { cancel(errAttemptTimeout) })
+
+	res, err := transport.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			res.Body.Close()
+		}
+		cancel(nil)
+		return nil, fmt.Errorf("%w after %s", errAttemptTimeout, timeout)
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// retarget returns a copy of req that is sent to the remote to instead of the remote from.
+func retarget(req *http.Request, from *url.URL, to *url.URL) *http.Request {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = to.Scheme
+	out.URL.Host = to.Host
+	out.URL.Path = to.Path + strings.TrimPrefix(req.URL.Path, from.Path)
+	out.URL.RawPath = ""
+	out.Host = to.Host
+	return out
+}
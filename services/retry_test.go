@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	p := &RetryPolicy{}
+	p.setDefaults()
+	if p.Attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", p.Attempts)
+	}
+	if len(p.Methods) != len(defaultRetryMethods) {
+		t.Errorf("expected methods %v, got %v", defaultRetryMethods, p.Methods)
+	}
+}
+
+func TestRetryPolicyRetryableRequest(t *testing.T) {
+	p := &RetryPolicy{}
+	p.setDefaults()
+	tests := map[string]struct {
+		method   string
+		body     string
+		expected bool
+	}{
+		"GET":           {method: http.MethodGet, expected: true},
+		"PUT":           {method: http.MethodPut, expected: true},
+		"POST":          {method: http.MethodPost, expected: false},
+		"PUT with body": {method: http.MethodPut, body: "body", expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "http://example.com", nil)
+			if test.body != "" {
+				r = httptest.NewRequest(test.method, "http://example.com", strings.NewReader(test.body))
+			}
+			if actual := p.retryableRequest(r); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetryableResult(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}
+	readErr := &net.OpError{Op: "read", Err: fmt.Errorf("connection reset")}
+	tests := map[string]struct {
+		policy   RetryPolicy
+		res      *http.Response
+		err      error
+		expected bool
+	}{
+		"dial error":          {policy: RetryPolicy{DialErrors: true}, err: dialErr, expected: true},
+		"dial error disabled": {policy: RetryPolicy{Timeouts: true}, err: dialErr, expected: false},
+		"timeout":             {policy: RetryPolicy{Timeouts: true}, err: errAttemptTimeout, expected: true},
+		"timeout disabled":    {policy: RetryPolicy{DialErrors: true}, err: errAttemptTimeout, expected: false},
+		"other error":         {policy: RetryPolicy{DialErrors: true, Timeouts: true}, err: readErr, expected: false},
+		"retried status code": {
+			policy:   RetryPolicy{StatusCodes: []int{502, 503}},
+			res:      &http.Response{StatusCode: http.StatusServiceUnavailable},
+			expected: true,
+		},
+		"not retried status code": {
+			policy:   RetryPolicy{StatusCodes: []int{502, 503}},
+			res:      &http.Response{StatusCode: http.StatusInternalServerError},
+			expected: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if actual := test.policy.retryableResult(test.res, test.err); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{Backoff: 10 * time.Millisecond}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
+	for i, backoff := range expected {
+		if actual := p.backoff(i + 1); actual != backoff {
+			t.Errorf("expected retry %d to back off %s, got %s", i+1, backoff, actual)
+		}
+	}
+}
+
+// closedServerURL returns the URL of a server that refuses connections.
+func closedServerURL(t *testing.T) url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.NotFoundHandler())
+	remote, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	return *remote
+}
+
+func statusServerURL(t *testing.T, status int, delay time.Duration) url.URL {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	remote, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *remote
+}
+
+func TestLoadBalancerRetry(t *testing.T) {
+	tests := map[string]struct {
+		remotes          []url.URL
+		policy           RetryPolicy
+		method           string
+		expectedCode     int
+		expectedAttempts string
+	}{
+		"retry dial error": {
+			remotes:          []url.URL{closedServerURL(t), statusServerURL(t, http.StatusTeapot, 0)},
+			policy:           RetryPolicy{Attempts: 3, DialErrors: true},
+			expectedCode:     http.StatusTeapot,
+			expectedAttempts: "2",
+		},
+		"retry status code": {
+			remotes: []url.URL{
+				statusServerURL(t, http.StatusServiceUnavailable, 0),
+				statusServerURL(t, http.StatusAccepted, 0),
+			},
+			policy:           RetryPolicy{Attempts: 3, StatusCodes: []int{502, 503}},
+			expectedCode:     http.StatusAccepted,
+			expectedAttempts: "2",
+		},
+		"retry timeout": {
+			remotes: []url.URL{
+				statusServerURL(t, http.StatusOK, 200*time.Millisecond),
+				statusServerURL(t, http.StatusAccepted, 0),
+			},
+			policy:           RetryPolicy{Attempts: 2, Timeouts: true, Timeout: 20 * time.Millisecond},
+			expectedCode:     http.StatusAccepted,
+			expectedAttempts: "2",
+		},
+		"attempts exhausted": {
+			remotes: []url.URL{
+				statusServerURL(t, http.StatusServiceUnavailable, 0),
+				statusServerURL(t, http.StatusBadGateway, 0),
+				statusServerURL(t, http.StatusBadGateway, 0),
+			},
+			policy:           RetryPolicy{Attempts: 2, StatusCodes: []int{502, 503}},
+			expectedCode:     http.StatusBadGateway,
+			expectedAttempts: "2",
+		},
+		"no other service": {
+			remotes:          []url.URL{statusServerURL(t, http.StatusServiceUnavailable, 0)},
+			policy:           RetryPolicy{Attempts: 3, StatusCodes: []int{503}, Backoff: time.Millisecond},
+			expectedCode:     http.StatusServiceUnavailable,
+			expectedAttempts: "1",
+		},
+		"non-idempotent method": {
+			remotes: []url.URL{
+				statusServerURL(t, http.StatusServiceUnavailable, 0),
+				statusServerURL(t, http.StatusAccepted, 0),
+			},
+			policy:           RetryPolicy{Attempts: 2, StatusCodes: []int{503}},
+			method:           http.MethodPost,
+			expectedCode:     http.StatusServiceUnavailable,
+			expectedAttempts: "1",
+		},
+		"all dial errors": {
+			remotes:          []url.URL{closedServerURL(t), closedServerURL(t)},
+			policy:           RetryPolicy{Attempts: 3, DialErrors: true},
+			expectedCode:     http.StatusBadGateway,
+			expectedAttempts: "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var pool []*Service
+			for i, remote := range test.remotes {
+				pool = append(pool, &Service{
+					Name:   fmt.Sprint(i),
+					Health: health.Always(true),
+					Router: NewRedirect(remote),
+				})
+			}
+			policy := test.policy
+			services := map[string]*Service{
+				"example.com": {
+					Router: NewLoadBalancer("example.com", &RoundRobin{}, pool, LoadBalancerOptions{Retry: &policy}),
+				},
+			}
+
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w, r := httptest.NewRecorder(), httptest.NewRequest(method, "http://example.com", nil)
+			Handler(services).ServeHTTP(w, r)
+
+			res := w.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != test.expectedCode {
+				t.Errorf("expected code %d got code %d", test.expectedCode, res.StatusCode)
+			}
+			if attempts := res.Header.Get(attemptsHeader); attempts != test.expectedAttempts {
+				t.Errorf("expected %s attempts, got %s", test.expectedAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	from := &url.URL{Scheme: "http", Host: "foo.example.com", Path: "/prefix"}
+	to := &url.URL{Scheme: "https", Host: "bar.example.com:8443", Path: "/other"}
+
+	r := httptest.NewRequest(http.MethodGet, "http://foo.example.com/prefix/path?query=1", nil)
+	actual := retarget(r, from, to)
+
+	expected := "https://bar.example.com:8443/other/path?query=1"
+	if actual.URL.String() != expected {
+		t.Errorf("expected %s, got %s", expected, actual.URL.String())
+	}
+	if actual.Host != to.Host {
+		t.Errorf("expected host %s, got %s", to.Host, actual.Host)
+	}
+	if r.URL.Host != from.Host {
+		t.Errorf("expected original request to be unchanged, got host %s", r.URL.Host)
+	}
+}
+
+func TestLoadBalancerRetryCancelledDuringBackoff(t *testing.T) {
+	limited := &Service{
+		Name:   "limited",
+		Health: health.Always(true),
+		Router: NewRedirect(statusServerURL(t, http.StatusAccepted, 0)),
+		Limit:  NewConnectionLimit(1),
+	}
+	failing := &Service{
+		Name:   "failing",
+		Health: health.Always(true),
+		Router: NewRedirect(statusServerURL(t, http.StatusServiceUnavailable, 0)),
+	}
+	pool := []*Service{failing, limited}
+	policy := RetryPolicy{Attempts: 2, StatusCodes: []int{http.StatusServiceUnavailable}, Backoff: time.Second}
+	services := map[string]*Service{
+		"example.com": {Router: NewLoadBalancer("example.com", &Failover{}, pool, LoadBalancerOptions{Retry: &policy})},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	Handler(services).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com", nil).WithContext(ctx))
+
+	if limited.Limit.full() {
+		t.Errorf("expected the connection of the cancelled retry to be released")
+	}
+}
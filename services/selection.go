@@ -4,14 +4,20 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"sync"
 )
 
-var errInvalidStrategy = fmt.Errorf("invalid strategy")
+var (
+	errInvalidStrategy    = fmt.Errorf("invalid strategy")
+	errNoAvailableService = fmt.Errorf("no available service")
+)
 
 // Strategy defines the interface for a load balancer selection strategy.
+// Implementations must be safe for concurrent use.
 type Strategy interface {
 	// Select returns the index of the next service to use.
-	Select([]*Service, *http.Request) int
+	// If none of the services are available, errNoAvailableService is returned.
+	Select([]*Service, *http.Request) (int, error)
 }
 
 // NewStrategy converts a string to a Strategy.
@@ -29,50 +35,155 @@ func NewStrategy(strategy string) (Strategy, error) {
 	}
 }
 
+// candidate is a healthy service that can be selected.
+type candidate struct {
+	index  int
+	weight float64
+}
+
+// available returns whether a service is healthy and below its connection limit.
+func available(service *Service) bool {
+	return service.Health.Up() && !service.Limit.full()
+}
+
+// candidates returns the available services along with their effective weights,
+// and whether they all have their full weight.
+func candidates(services []*Service) ([]candidate, bool) {
+	var healthy []candidate
+	fullWeight := true
+	for i, item := range services {
+		if !available(item) {
+			continue
+		}
+		w := weight(item)
+		fullWeight = fullWeight && w >= 1
+		healthy = append(healthy, candidate{index: i, weight: w})
+	}
+	return healthy, fullWeight
+}
+
 // Failover is a failover selection strategy.
-type Failover struct{}
+type Failover struct {
+	mu sync.Mutex
+	// credits accumulate the weights of services that do not have their full weight.
+	credits []float64
+}
 
 // Select returns the index of the first service that is healthy.
-func (f *Failover) Select(services []*Service, _ *http.Request) int {
-	for i, item := range services {
-		if item.Health.Up() {
-			return i
+// A service with a reduced weight only receives that share of its requests,
+// and the remaining requests fail over to the next healthy service.
+func (f *Failover) Select(services []*Service, _ *http.Request) (int, error) {
+	healthy, fullWeight := candidates(services)
+	if len(healthy) == 0 {
+		return 0, errNoAvailableService
+	}
+	if fullWeight {
+		return healthy[0].index, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.credits) != len(services) {
+		f.credits = make([]float64, len(services))
+	}
+	for _, c := range healthy {
+		if c.weight >= 1 {
+			return c.index, nil
+		}
+		f.credits[c.index] += c.weight
+		if f.credits[c.index] >= 1 {
+			f.credits[c.index]--
+			return c.index, nil
 		}
 	}
-	return 0
+	return healthy[0].index, nil
 }
 
 // RoundRobin is a round-robin selection strategy.
 type RoundRobin struct {
+	mu   sync.Mutex
 	next int
+	// current holds the current weights of a smooth weighted round-robin,
+	// which is used when some services do not have their full weight.
+	current []float64
 }
 
 // Select returns the index of the next service to use using a round-robin strategy.
-func (r *RoundRobin) Select(services []*Service, _ *http.Request) int {
-	for i := r.next; i < len(services)+r.next; i++ {
-		if services[i%len(services)].Health.Up() {
-			r.next = (i + 1) % len(services)
-			return i % len(services)
+// If some services do not have their full weight, a smooth weighted round-robin is used instead.
+func (r *RoundRobin) Select(services []*Service, _ *http.Request) (int, error) {
+	healthy, fullWeight := candidates(services)
+	if len(healthy) == 0 {
+		return 0, errNoAvailableService
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !fullWeight {
+		return r.selectWeighted(services, healthy), nil
+	}
+	for _, c := range healthy {
+		if c.index >= r.next {
+			r.next = (c.index + 1) % len(services)
+			return c.index, nil
+		}
+	}
+	r.next = (healthy[0].index + 1) % len(services)
+	return healthy[0].index, nil
+}
+
+func (r *RoundRobin) selectWeighted(services []*Service, healthy []candidate) int {
+	if len(r.current) != len(services) {
+		r.current = make([]float64, len(services))
+	}
+	total := 0.0
+	best := healthy[0].index
+	for _, c := range healthy {
+		r.current[c.index] += c.weight
+		total += c.weight
+		if r.current[c.index] > r.current[best] {
+			best = c.index
 		}
 	}
-	return 0
+	r.current[best] -= total
+	r.next = (best + 1) % len(services)
+	return best
 }
 
+// randomWeightScale converts effective weights to integers for a weighted random selection.
+const randomWeightScale = 1000
+
 // Random is a random selection strategy.
 type Random struct {
+	mu  sync.Mutex
 	rng func(int) int
 }
 
 // Select returns the index of the next service to use using a random strategy.
-func (r *Random) Select(services []*Service, _ *http.Request) int {
-	var validIndices []int
-	for i, item := range services {
-		if item.Health.Up() {
-			validIndices = append(validIndices, i)
-		}
+// Services are chosen with a probability proportional to their effective weight.
+func (r *Random) Select(services []*Service, _ *http.Request) (int, error) {
+	healthy, fullWeight := candidates(services)
+	if len(healthy) == 0 {
+		return 0, errNoAvailableService
 	}
-	if len(validIndices) == 0 {
-		return 0
+	// The rng is not necessarily safe for concurrent use (e.g. a seeded *rand.Rand).
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fullWeight {
+		return healthy[r.rng(len(healthy))].index, nil
+	}
+
+	weights := make([]int, len(healthy))
+	total := 0
+	for i, c := range healthy {
+		weights[i] = max(1, int(c.weight*randomWeightScale))
+		total += weights[i]
+	}
+	pick := r.rng(total)
+	for i, w := range weights {
+		if pick < w {
+			return healthy[i].index, nil
+		}
+		pick -= w
 	}
-	return validIndices[r.rng(len(validIndices))]
+	return healthy[len(healthy)-1].index, nil
 }
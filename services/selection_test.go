@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"reflect"
 	"slices"
+	"sync"
 	"testing"
 
 	"github.com/plamorg/voltproxy/services/health"
@@ -56,10 +57,6 @@ func TestFailoverSelect(t *testing.T) {
 		services []*Service
 		expected []int
 	}{
-		"no services": {
-			services: []*Service{},
-			expected: []int{0, 0, 0},
-		},
 		"first service": {
 			services: []*Service{
 				{Health: health.Always(true)},
@@ -76,13 +73,6 @@ func TestFailoverSelect(t *testing.T) {
 			},
 			expected: []int{2, 2, 2},
 		},
-		"all failing services": {
-			services: []*Service{
-				{Health: health.Always(false)},
-				{Health: health.Always(false)},
-			},
-			expected: []int{0, 0, 0},
-		},
 	}
 
 	for name, test := range tests {
@@ -90,7 +80,11 @@ func TestFailoverSelect(t *testing.T) {
 			actual := make([]int, 0, len(test.expected))
 			f := &Failover{}
 			for i := 0; i < len(test.expected); i++ {
-				actual = append(actual, f.Select(test.services, nil))
+				next, err := f.Select(test.services, nil)
+				if err != nil {
+					t.Fatalf("expected nil, got %v", err)
+				}
+				actual = append(actual, next)
 			}
 			if !slices.Equal(actual, test.expected) {
 				t.Errorf("expected %v, got %v", test.expected, actual)
@@ -104,10 +98,6 @@ func TestRoundRobinSelect(t *testing.T) {
 		services []*Service
 		expected []int
 	}{
-		"no services": {
-			services: []*Service{},
-			expected: []int{0, 0, 0},
-		},
 		"wrap around": {
 			services: []*Service{
 				{Health: health.Always(true)},
@@ -135,7 +125,11 @@ func TestRoundRobinSelect(t *testing.T) {
 			actual := make([]int, 0, len(test.expected))
 			r := &RoundRobin{next: 0}
 			for i := 0; i < len(test.expected); i++ {
-				actual = append(actual, r.Select(test.services, nil))
+				next, err := r.Select(test.services, nil)
+				if err != nil {
+					t.Fatalf("expected nil, got %v", err)
+				}
+				actual = append(actual, next)
 			}
 			if !slices.Equal(actual, test.expected) {
 				t.Errorf("expected %v, got %v", test.expected, actual)
@@ -149,18 +143,6 @@ func TestRandomSelect(t *testing.T) {
 		services []*Service
 		expected []int
 	}{
-		"no services": {
-			services: []*Service{},
-			expected: []int{0, 0, 0},
-		},
-		"all down": {
-			services: []*Service{
-				{Health: health.Always(false)},
-				{Health: health.Always(false)},
-				{Health: health.Always(false)},
-			},
-			expected: []int{0, 0, 0},
-		},
 		"varying health": {
 			services: []*Service{
 				{Health: health.Always(false)},
@@ -181,7 +163,11 @@ func TestRandomSelect(t *testing.T) {
 			actual := make([]int, 0, len(test.expected))
 			r := &Random{rng: rand.New(rand.NewSource(0)).Intn} // #nosec
 			for i := 0; i < len(test.expected); i++ {
-				actual = append(actual, r.Select(test.services, nil))
+				next, err := r.Select(test.services, nil)
+				if err != nil {
+					t.Fatalf("expected nil, got %v", err)
+				}
+				actual = append(actual, next)
 			}
 			if !slices.Equal(actual, test.expected) {
 				t.Errorf("expected %v, got %v", test.expected, actual)
@@ -189,3 +175,182 @@ func TestRandomSelect(t *testing.T) {
 		})
 	}
 }
+
+func TestStrategySelectNoAvailableService(t *testing.T) {
+	strategies := map[string]func() Strategy{
+		"failover":   func() Strategy { return &Failover{} },
+		"roundRobin": func() Strategy { return &RoundRobin{next: 0} },
+		"random":     func() Strategy { return &Random{rng: rand.New(rand.NewSource(0)).Intn} }, // #nosec
+	}
+	pools := map[string][]*Service{
+		"no services": {},
+		"all down": {
+			{Health: health.Always(false)},
+			{Health: health.Always(false)},
+			{Health: health.Always(false)},
+		},
+	}
+
+	for strategyName, newStrategy := range strategies {
+		for poolName, services := range pools {
+			t.Run(fmt.Sprintf("%s %s", strategyName, poolName), func(t *testing.T) {
+				s := newStrategy()
+				for i := 0; i < 3; i++ {
+					if _, err := s.Select(services, nil); !errors.Is(err, errNoAvailableService) {
+						t.Fatalf("expected %v, got %v", errNoAvailableService, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStrategySelectConcurrent(t *testing.T) {
+	const (
+		goroutines = 8
+		selections = 300
+	)
+	services := []*Service{
+		{Health: health.Always(true)},
+		{Health: health.Always(false)},
+		{Health: health.Always(true)},
+		{Health: health.Always(true)},
+	}
+	strategies := map[string]Strategy{
+		"failover":   &Failover{},
+		"roundRobin": &RoundRobin{next: 0},
+		"random":     &Random{rng: rand.New(rand.NewSource(0)).Intn}, // #nosec
+	}
+
+	for name, s := range strategies {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			counts := make([]int, len(services))
+
+			var wg sync.WaitGroup
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < selections; i++ {
+						next, err := s.Select(services, nil)
+						if err != nil {
+							t.Errorf("expected nil, got %v", err)
+							return
+						}
+						mu.Lock()
+						counts[next]++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if counts[1] != 0 {
+				t.Errorf("expected unhealthy service to never be selected, got %d selections", counts[1])
+			}
+			if _, ok := s.(*RoundRobin); ok {
+				// Every healthy service should get an equal share of a round-robin.
+				share := goroutines * selections / 3
+				for _, i := range []int{0, 2, 3} {
+					if counts[i] != share {
+						t.Errorf("expected service %d to be selected %d times, got %d", i, share, counts[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// weightedHealth is a healthy health checker with a fixed effective weight.
+type weightedHealth struct {
+	health.Always
+	weight float64
+}
+
+func (w weightedHealth) Weight() float64 {
+	return w.weight
+}
+
+func TestStrategySelectWeighted(t *testing.T) {
+	services := []*Service{
+		{Health: weightedHealth{Always: true, weight: 1}},
+		{Health: weightedHealth{Always: true, weight: 0.5}},
+		{Health: health.Always(false)},
+		{Health: weightedHealth{Always: true, weight: 0.25}},
+	}
+	tests := map[string]struct {
+		strategy Strategy
+		expected []int
+	}{
+		"failover": {
+			// The first service has its full weight, so the other services are never used.
+			strategy: &Failover{},
+			expected: []int{0, 0, 0, 0, 0, 0, 0},
+		},
+		"roundRobin": {
+			strategy: &RoundRobin{},
+			expected: []int{0, 1, 0, 3, 0, 1, 0},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			actual := make([]int, 0, len(test.expected))
+			for i := 0; i < len(test.expected); i++ {
+				next, err := test.strategy.Select(services, nil)
+				if err != nil {
+					t.Fatalf("expected nil, got %v", err)
+				}
+				actual = append(actual, next)
+			}
+			if !slices.Equal(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFailoverSelectWeighted(t *testing.T) {
+	services := []*Service{
+		{Health: weightedHealth{Always: true, weight: 0.25}},
+		{Health: health.Always(true)},
+	}
+	expected := []int{1, 1, 1, 0, 1, 1, 1, 0}
+
+	f := &Failover{}
+	actual := make([]int, 0, len(expected))
+	for range expected {
+		next, err := f.Select(services, nil)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		actual = append(actual, next)
+	}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestRandomSelectWeighted(t *testing.T) {
+	services := []*Service{
+		{Health: weightedHealth{Always: true, weight: 1}},
+		{Health: weightedHealth{Always: true, weight: 0.1}},
+	}
+
+	const selections = 11000
+	r := &Random{rng: rand.New(rand.NewSource(0)).Intn} // #nosec
+	counts := make([]int, len(services))
+	for i := 0; i < selections; i++ {
+		next, err := r.Select(services, nil)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		counts[next]++
+	}
+
+	// The second service should receive roughly a tenth of the first service's requests.
+	if counts[1] < 700 || counts[1] > 1300 {
+		t.Errorf("expected around 1000 selections of the second service, got %d", counts[1])
+	}
+}
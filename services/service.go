@@ -2,15 +2,25 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"time"
 
+	"github.com/plamorg/voltproxy/logging"
 	"github.com/plamorg/voltproxy/middlewares"
+	"github.com/plamorg/voltproxy/notify"
 	"github.com/plamorg/voltproxy/services/health"
+	"github.com/plamorg/voltproxy/tracing"
 )
 
+// noAvailableServiceRetryAfter is the number of seconds a client is told to wait
+// before retrying when no service is available to handle its request.
+const noAvailableServiceRetryAfter = 5
+
 // Router is something that can route a request to a service.
 type Router interface {
 	Route(http.ResponseWriter, *http.Request) (*url.URL, error)
@@ -18,60 +28,189 @@ type Router interface {
 
 // Service is a service that can be proxied.
 type Service struct {
+	// Name is the name of the service as given in the configuration.
+	Name string
+
 	TLS         bool
 	Middlewares []middlewares.Middleware
 	Health      health.Checker
+	// Limit limits the number of concurrent requests load balancers proxy to the service.
+	// If nil, the number of requests is not limited.
+	Limit *ConnectionLimit
 
 	Router Router
 }
 
-// LaunchHealthChecks starts the health checks for all services.
-func LaunchHealthChecks(services map[string]*Service) {
+// hostService is a service along with its host, which is empty for load balancer members without a host.
+type hostService struct {
+	host    string
+	service *Service
+}
+
+// withMembers returns the services along with the members of their load balancers, each service once,
+// so that the health of members without a host of their own is checked too.
+func withMembers(services map[string]*Service) []hostService {
+	seen := make(map[*Service]bool, len(services))
+	all := make([]hostService, 0, len(services))
 	for host, service := range services {
+		seen[service] = true
+		all = append(all, hostService{host: host, service: service})
+	}
+	for _, service := range services {
+		lb, ok := service.Router.(*LoadBalancer)
+		if !ok {
+			continue
+		}
+		for _, backend := range lb.backends {
+			if !seen[backend] {
+				seen[backend] = true
+				all = append(all, hostService{service: backend})
+			}
+		}
+	}
+	return all
+}
+
+// LaunchHealthChecks starts the health checks for all services, including the members of load balancers.
+// The notifier, if any, is notified whenever a service changes between up and down.
+func LaunchHealthChecks(services map[string]*Service, notifier notify.Notifier) {
+	for _, s := range withMembers(services) {
 		// This is a workaround for the loop variable problem.
 		// See: https://github.com/golang/go/wiki/LoopvarExperiment
-		service := service
+		host, service := s.host, s.service
 
 		logger := slog.Default().With(slog.String("host", host), slog.Any("service", service))
 
-		go service.Health.Launch(service.Router.Route)
+		// Routers without an endpoint of their own, such as load balancers, have health checkers
+		// that do not need a target.
+		target, _ := service.Router.(health.Target)
+		go service.Health.Launch(target)
+		results := service.Health.Check()
+		if results == nil {
+			continue
+		}
+		// A service that inherited its state from the service it replaces only notifies actual changes.
+		initial := service.Health.History().State
 		go func() {
-			for {
-				res := <-service.Health.Check()
+			state := initial
+			for res := range results {
 				if res.Err != nil || !res.Up {
 					logger.Warn("Failed health check", slog.Any("result", res))
 				} else {
 					logger.Debug("Successful Health check", slog.Any("result", res))
 				}
+				if state != health.StateUnknown && res.State != health.StateUnknown && res.State != state {
+					logger.Info("Service changed state",
+						slog.String("previous", string(state)),
+						slog.String("state", string(res.State)),
+						slog.Any("uptime", service.Health.History().Uptime))
+					if notifier != nil {
+						notifier.Notify(stateChange(host, service, state, res))
+					}
+				}
+				if res.State != health.StateUnknown {
+					state = res.State
+				}
 			}
 		}()
 	}
 }
 
+// StopHealthChecks stops the health checks of all services, including the members of load balancers,
+// e.g. once they have been replaced.
+func StopHealthChecks(services map[string]*Service) {
+	for _, s := range withMembers(services) {
+		s.service.Health.Stop()
+	}
+}
+
+// InheritHealth carries the health of the previous services over to the services with the same name replacing them,
+// along with the ejections and slow start of load balancer members, so that reloading the configuration neither
+// makes services unavailable until they are checked again nor forgets their history.
+// It must be called before the health checks of the services are launched.
+func InheritHealth(services, previous map[string]*Service) {
+	byName := make(map[string]*Service)
+	for _, s := range withMembers(previous) {
+		if s.service.Name != "" {
+			byName[s.service.Name] = s.service
+		}
+	}
+	for _, s := range withMembers(services) {
+		prev, ok := byName[s.service.Name]
+		if !ok || s.service.Name == "" {
+			continue
+		}
+		health.Inherit(s.service.Health, prev.Health)
+		lb, ok := s.service.Router.(*LoadBalancer)
+		prevLB, prevOK := prev.Router.(*LoadBalancer)
+		if ok && prevOK {
+			lb.inheritMembers(prevLB)
+		}
+	}
+}
+
+// stateChange returns the event of a service changing state.
+func stateChange(host string, service *Service, previous health.State, res health.Result) notify.Event {
+	event := notify.Event{
+		Host:     host,
+		Service:  service.Name,
+		State:    string(res.State),
+		Previous: string(previous),
+		Endpoint: res.Endpoint,
+		Time:     time.Now(),
+	}
+	if res.Err != nil {
+		event.Error = res.Err.Error()
+	}
+	return event
+}
+
 // Handler returns a http.Handler that proxies requests to services, redirecting to TLS if applicable.
 func Handler(services map[string]*Service) http.Handler {
-	return handler(services, false)
+	return handler(staticServices(services), false)
 }
 
 // TLSHandler returns a http.Handler that proxies requests to services with TLS enabled.
 func TLSHandler(services map[string]*Service) http.Handler {
-	return handler(services, true)
+	return handler(staticServices(services), true)
 }
 
-func handler(services map[string]*Service, tls bool) http.Handler {
+// staticServices returns a function that always returns the same services.
+func staticServices(services map[string]*Service) func() map[string]*Service {
+	return func() map[string]*Service {
+		return services
+	}
+}
+
+// handler returns a http.Handler that proxies requests to the services returned by the given function.
+func handler(services func() map[string]*Service, tls bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := slog.Default().With(slog.String("host", r.Host), slog.Bool("tls", tls))
+		// The request ID is sent to the backend along with the request and returned to the client.
+		requestID := logging.RequestID(r)
+		r.Header.Set(logging.RequestIDHeader, requestID)
+		w.Header().Set(logging.RequestIDHeader, requestID)
+
+		logger := logging.RequestLogger(r).With(slog.String("host", r.Host), slog.Bool("tls", tls))
 
 		logger.Debug("Handling request")
 
-		service, ok := services[r.Host]
+		service, ok := services()[r.Host]
 		if !ok {
 			logger.Debug("No service found for host")
+			routingErrors.Inc("", routingErrorUnknownHost)
+			entry := accessEntry(r)
 			w.WriteHeader(http.StatusNotFound)
+			entry.Status, entry.Duration = http.StatusNotFound, time.Since(entry.Time)
+			logAccess(r, entry)
 			return
 		}
 		logger = logger.With(slog.Any("service", service))
 
+		m := measureRequest(service.Name, w, r)
+		w = m.recorder
+		defer m.done(r)
+		r = m.trace(r)
+
 		if service.TLS && !tls {
 			redirectURL := "https://" + r.Host + r.URL.String()
 			logger.Debug("Redirecting to TLS server", slog.String("redirect", redirectURL))
@@ -80,31 +219,47 @@ func handler(services map[string]*Service, tls bool) http.Handler {
 		}
 		if !service.TLS && tls {
 			logger.Debug("Service does not support TLS")
+			routingErrors.Inc(service.Name, routingErrorTLSNotSupported)
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
-		route, err := service.Router.Route(w, r)
+		sel := &selection{}
+		defer sel.release()
+		route, err := service.Router.Route(w, r.WithContext(withSelection(r.Context(), sel)))
 		if err != nil {
 			logger.Warn("Error while routing to service", slog.Any("error", err))
+			routingErrors.Inc(service.Name, routingErrorType(err))
 			status := http.StatusInternalServerError
+			if errors.Is(err, errNoAvailableService) {
+				status = http.StatusServiceUnavailable
+				w.Header().Set("Retry-After", fmt.Sprint(noAvailableServiceRetryAfter))
+			}
 			w.WriteHeader(status)
 			return
 		}
 		logger = logger.With(slog.String("route", route.String()))
+		m.backend, m.sel = route.String(), sel
 
 		var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			proxy := httputil.NewSingleHostReverseProxy(route)
+			transport := http.DefaultTransport
+			if router, ok := service.Router.(http.RoundTripper); ok {
+				transport = router
+			}
+			proxy.Transport = tracing.Transport(upstreamSpanName, transport)
+			proxy.ModifyResponse = func(res *http.Response) error {
+				// The response already has the request ID, which the backend may have echoed.
+				res.Header.Del(logging.RequestIDHeader)
+				return nil
+			}
 			r.Host = route.Host
 			logger.Debug("Proxying request")
-			proxy.ServeHTTP(w, r)
+			proxy.ServeHTTP(w, r.WithContext(withSelection(r.Context(), sel)))
 		})
 
-		middlewares := service.Middlewares
-		if len(middlewares) > 0 {
-			for _, middleware := range middlewares {
-				handler = middleware.Handle(handler)
-			}
+		for _, middleware := range service.Middlewares {
+			handler = traceMiddleware(middlewares.Name(middleware), middleware.Handle(handler))
 		}
 
 		handler.ServeHTTP(w, r)
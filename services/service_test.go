@@ -5,10 +5,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/plamorg/voltproxy/logging"
 	"github.com/plamorg/voltproxy/middlewares"
+	"github.com/plamorg/voltproxy/notify"
+	"github.com/plamorg/voltproxy/services/health"
 )
 
 func TestHandlerSuccess(t *testing.T) {
@@ -118,6 +123,32 @@ func TestHandlerRedirectToTLS(t *testing.T) {
 	}
 }
 
+func TestHandlerNoAvailableService(t *testing.T) {
+	services := map[string]*Service{
+		"example.com": {
+			Router: NewLoadBalancer("example.com", &RoundRobin{}, []*Service{
+				{
+					Health: health.Always(false),
+					Router: NewRedirect(url.URL{Scheme: "http", Host: "foo.example.com"}),
+				},
+			}, LoadBalancerOptions{}),
+		},
+	}
+
+	w, r := httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+	Handler(services).ServeHTTP(w, r)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected code %d got code %d", http.StatusServiceUnavailable, res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Errorf("expected Retry-After header to be set")
+	}
+}
+
 type mockMiddleware struct{}
 
 func (m *mockMiddleware) Handle(_ http.Handler) http.Handler {
@@ -147,3 +178,157 @@ func TestHandlerAddsMiddlewares(t *testing.T) {
 		t.Errorf("expected middleware to be added")
 	}
 }
+
+// channelHealth is a health checker whose results are sent by tests.
+type channelHealth struct {
+	health.Always
+	c chan health.Result
+}
+
+func (c *channelHealth) Check() <-chan health.Result {
+	return c.c
+}
+
+// recordingNotifier records the events it is notified of.
+type recordingNotifier chan notify.Event
+
+func (r recordingNotifier) Notify(event notify.Event) {
+	r <- event
+}
+
+func TestLaunchHealthChecksNotifies(t *testing.T) {
+	checker := &channelHealth{Always: true, c: make(chan health.Result)}
+	notifier := make(recordingNotifier, 10)
+	LaunchHealthChecks(map[string]*Service{
+		"example.com": {Name: "foo", Health: checker, Router: NewRedirect(url.URL{})},
+	}, notifier)
+
+	for _, state := range []health.State{
+		health.StateUnknown, health.StateUp, health.StateUp, health.StateDown, health.StateDown, health.StateUp,
+	} {
+		checker.c <- health.Result{Up: state == health.StateUp, State: state}
+	}
+	// Wait for the last result to be handled.
+	checker.c <- health.Result{Up: true, State: health.StateUp}
+
+	close(notifier)
+	var changes []string
+	for event := range notifier {
+		if event.Host != "example.com" || event.Service != "foo" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		changes = append(changes, event.Previous+"->"+event.State)
+	}
+	expected := []string{"up->down", "down->up"}
+	if !slices.Equal(changes, expected) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+}
+
+func TestLaunchHealthChecksGroupStartup(t *testing.T) {
+	// The member has no host, and is only checked as a member of the load balancer.
+	member := &Service{
+		Name:   "member",
+		Health: health.NewTCP(health.Info{Interval: time.Millisecond}),
+		Router: NewRedirect(url.URL{}),
+	}
+	lb := NewLoadBalancer("lb.example.com", &RoundRobin{}, []*Service{member}, LoadBalancerOptions{})
+	group := health.NewGroup(health.Info{Interval: time.Millisecond}, health.Policy{}, lb.Members())
+	serviceMap := map[string]*Service{"lb.example.com": {Name: "lb", Health: group, Router: lb}}
+	notifier := make(recordingNotifier, 10)
+	LaunchHealthChecks(serviceMap, notifier)
+	defer StopHealthChecks(serviceMap)
+
+	// Once a second result is recorded, the first one has been handled.
+	deadline := time.Now().Add(time.Second)
+	for len(group.History().Results) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the load balancer's health to be known")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if state := group.History().Results[0].State; state != health.StateDown {
+		t.Errorf("expected first state %s, got %s", health.StateDown, state)
+	}
+	if len(notifier) != 0 {
+		t.Errorf("expected no notification at startup, got %+v", <-notifier)
+	}
+}
+
+func TestInheritHealth(t *testing.T) {
+	detection := &OutlierDetection{ConsecutiveFailures: 1, BaseEjectionTime: time.Hour}
+	servicesOf := func(info health.Info) (map[string]*Service, *LoadBalancer) {
+		member := &Service{Name: "member", Health: health.NewTCP(info), Router: NewRedirect(url.URL{})}
+		lb := NewLoadBalancer("lb.example.com", &RoundRobin{}, []*Service{member},
+			LoadBalancerOptions{OutlierDetection: detection})
+		return map[string]*Service{"lb.example.com": {Name: "lb", Health: health.Always(true), Router: lb}}, lb
+	}
+
+	previous, previousLB := servicesOf(health.Info{Interval: time.Millisecond})
+	LaunchHealthChecks(previous, nil)
+	defer StopHealthChecks(previous)
+	deadline := time.Now().Add(time.Second)
+	for previousLB.backends[0].Health.History().State != health.StateDown {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected member to be down")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	previousLB.services[0].Health.(*member).outlier.report(true)
+
+	next, nextLB := servicesOf(health.Info{Interval: time.Hour})
+	InheritHealth(next, previous)
+	if state := nextLB.backends[0].Health.History().State; state != health.StateDown {
+		t.Errorf("expected inherited state %s, got %s", health.StateDown, state)
+	}
+	if !nextLB.services[0].Health.(*member).outlier.ejected() {
+		t.Errorf("expected inherited ejection")
+	}
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(logging.RequestIDHeader)
+		// The backend echoes the request ID, which must not be duplicated in the response.
+		w.Header().Set(logging.RequestIDHeader, received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Handler(map[string]*Service{"example.com": {Router: NewRedirect(*backendURL)}})
+
+	tests := map[string]struct {
+		trustedIPs []string
+		reused     bool
+	}{
+		"untrusted": {trustedIPs: nil, reused: false},
+		"trusted":   {trustedIPs: []string{"192.0.2.0/24"}, reused: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := logging.Config{RequestID: logging.RequestIDConfig{TrustedIPs: test.trustedIPs}}
+			if err := c.Initialize(); err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = (&logging.Config{}).Initialize() }()
+
+			const incoming = "incoming-id"
+			r, w := httptest.NewRequest(http.MethodGet, "http://example.com", nil), httptest.NewRecorder()
+			r.Header.Set(logging.RequestIDHeader, incoming)
+			handler.ServeHTTP(w, r)
+
+			returned := w.Result().Header.Values(logging.RequestIDHeader)
+			if len(returned) != 1 || returned[0] != received {
+				t.Fatalf("expected request ID %s sent to the backend, got %v", received, returned)
+			}
+			if (received == incoming) != test.reused {
+				t.Errorf("expected incoming request ID reused %v, got %s", test.reused, received)
+			}
+		})
+	}
+}
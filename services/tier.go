@@ -0,0 +1,63 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+// Tier is a priority group of consecutive services in a Tiered strategy.
+type Tier struct {
+	// Size is the number of services in the tier.
+	Size int
+	// Strategy selects a service within the tier.
+	Strategy Strategy
+	// MinAvailable is the number of available services needed, counting those of spilled over
+	// tiers before it, for the tier to handle requests. If fewer services are available,
+	// requests spill over to the next tier as well. Defaults to 1.
+	MinAvailable int
+}
+
+// Tiered is a priority-tiered selection strategy.
+// Services are split into tiers in order, and a lower priority tier is only used
+// once the tiers before it do not have enough available services.
+type Tiered struct {
+	tiers []Tier
+}
+
+// NewTiered creates a new Tiered strategy from tiers in order of priority.
+func NewTiered(tiers []Tier) *Tiered {
+	for i := range tiers {
+		tiers[i].MinAvailable = max(tiers[i].MinAvailable, 1)
+	}
+	return &Tiered{tiers: tiers}
+}
+
+// unavailableService stands in for services that must not be selected while keeping indices intact.
+var unavailableService = &Service{Health: health.Always(false)}
+
+// Select returns the index of a service in the first tier with enough available services.
+// When a tier spills over, the next tier's strategy selects among the available services
+// of both tiers.
+func (t *Tiered) Select(services []*Service, r *http.Request) (int, error) {
+	pool := make([]*Service, len(services))
+	for i := range pool {
+		pool[i] = unavailableService
+	}
+
+	start, count := 0, 0
+	for i, tier := range t.tiers {
+		end := min(start+tier.Size, len(services))
+		for j := start; j < end; j++ {
+			pool[j] = services[j]
+			if available(services[j]) {
+				count++
+			}
+		}
+		start = end
+		if count > 0 && (count >= tier.MinAvailable || i == len(t.tiers)-1) {
+			return tier.Strategy.Select(pool, r)
+		}
+	}
+	return 0, errNoAvailableService
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/plamorg/voltproxy/services/health"
+)
+
+func TestTieredSelect(t *testing.T) {
+	tests := map[string]struct {
+		tiers    []Tier
+		services []*Service
+		expected []int
+	}{
+		"first tier healthy": {
+			tiers: []Tier{{Size: 2, Strategy: &RoundRobin{}}, {Size: 2, Strategy: &RoundRobin{}}},
+			services: []*Service{
+				{Health: health.Always(true)},
+				{Health: health.Always(true)},
+				{Health: health.Always(true)},
+				{Health: health.Always(true)},
+			},
+			expected: []int{0, 1, 0, 1},
+		},
+		"first tier down": {
+			tiers: []Tier{{Size: 2, Strategy: &RoundRobin{}}, {Size: 2, Strategy: &RoundRobin{}}},
+			services: []*Service{
+				{Health: health.Always(false)},
+				{Health: health.Always(false)},
+				{Health: health.Always(true)},
+				{Health: health.Always(true)},
+			},
+			expected: []int{2, 3, 2, 3},
+		},
+		"first tier partially down": {
+			tiers: []Tier{{Size: 2, Strategy: &RoundRobin{}}, {Size: 2, Strategy: &RoundRobin{}}},
+			services: []*Service{
+				{Health: health.Always(false)},
+				{Health: health.Always(true)},
+				{Health: health.Always(true)},
+				{Health: health.Always(true)},
+			},
+			expected: []int{1, 1, 1, 1},
+		},
+		"spill over below min available": {
+			tiers: []Tier{{Size: 2, Strategy: &RoundRobin{}, MinAvailable: 2}, {Size: 2, Strategy: &RoundRobin{}}},
+			services: []*Service{
+				{Health: health.Always(false)},
+				{Health: health.Always(true)},
+				{Health: health.Always(true)},
+				{Health: health.Always(false)},
+			},
+			expected: []int{1, 2, 1, 2},
+		},
+		"last tier below min available": {
+			tiers: []Tier{{Size: 1, Strategy: &Failover{}}, {Size: 2, Strategy: &RoundRobin{}, MinAvailable: 3}},
+			services: []*Service{
+				{Health: health.Always(false)},
+				{Health: health.Always(true)},
+				{Health: health.Always(false)},
+			},
+			expected: []int{1, 1},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tiered := NewTiered(test.tiers)
+			actual := make([]int, 0, len(test.expected))
+			for i := 0; i < len(test.expected); i++ {
+				next, err := tiered.Select(test.services, nil)
+				if err != nil {
+					t.Fatalf("expected nil, got %v", err)
+				}
+				actual = append(actual, next)
+			}
+			if !slices.Equal(actual, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTieredSelectNoAvailableService(t *testing.T) {
+	tiered := NewTiered([]Tier{{Size: 1, Strategy: &RoundRobin{}}, {Size: 1, Strategy: &RoundRobin{}}})
+	_, err := tiered.Select([]*Service{
+		{Health: health.Always(false)},
+		{Health: health.Always(false)},
+	}, nil)
+	if !errors.Is(err, errNoAvailableService) {
+		t.Errorf("expected %v, got %v", errNoAvailableService, err)
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/plamorg/voltproxy/tracing"
+)
+
+// upstreamSpanName is the name of the spans of round trips to services.
+const upstreamSpanName = "upstream"
+
+// trace starts the server span of the request, which is ended once the request has been handled.
+// The request is only replaced by one within the span if tracing is enabled.
+func (m *measurement) trace(r *http.Request) *http.Request {
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method, tracing.KindServer)
+	if span == nil {
+		return r
+	}
+	span.SetAttributes(
+		tracing.String("http.request.method", r.Method),
+		tracing.String("url.path", r.URL.Path),
+		tracing.String("server.address", r.Host),
+		tracing.String("client.address", m.entry.ClientIP),
+		tracing.String("user_agent.original", r.UserAgent()),
+		tracing.String("voltproxy.service", m.service))
+	m.span = span
+	return r.WithContext(ctx)
+}
+
+// endSpan ends the server span of the request, if any, with the status code of the response.
+func (m *measurement) endSpan(status int) {
+	if m.span == nil {
+		return
+	}
+	if m.backend != "" {
+		m.span.SetAttributes(tracing.String("voltproxy.backend", m.backend))
+	}
+	m.span.SetAttributes(tracing.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		m.span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+	}
+	m.span.End()
+}
+
+// traceMiddleware handles requests with a middleware within a span of the given middleware name.
+func traceMiddleware(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), name, tracing.KindInternal)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
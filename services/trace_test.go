@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plamorg/voltproxy/middlewares"
+	"github.com/plamorg/voltproxy/tracing"
+)
+
+// exportedSpan is the part of an OTLP span that is checked.
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+}
+
+// newCollector starts a stand-in for an OTLP/HTTP collector, returning it and the spans it received.
+func newCollector(t *testing.T) (*httptest.Server, func() map[string]exportedSpan) {
+	t.Helper()
+	var mu sync.Mutex
+	spans := make(map[string]exportedSpan)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("expected OTLP request, got %v", err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() map[string]exportedSpan {
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+// traceparentRecorder returns a handler that records the traceparent header of the last request.
+func traceparentRecorder(traceparent *string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestHandlerTracing(t *testing.T) {
+	collector, exported := newCollector(t)
+	var authTraceparent, backendTraceparent string
+	authServer := httptest.NewServer(traceparentRecorder(&authTraceparent))
+	defer authServer.Close()
+	backend := httptest.NewServer(traceparentRecorder(&backendTraceparent))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&tracing.Config{Endpoint: collector.URL, Interval: time.Hour}).Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	handler := Handler(map[string]*Service{
+		"traced.example.com": {
+			Name:        "traced",
+			Middlewares: []middlewares.Middleware{&middlewares.AuthForward{Address: authServer.URL}},
+			Router:      NewRedirect(*backendURL),
+		},
+	})
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest(http.MethodGet, "http://traced.example.com/foo", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	// Disabling tracing exports the spans.
+	if err := (*tracing.Config)(nil).Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exported()
+	parents := map[string]string{
+		"GET":                 "00f067aa0ba902b7",
+		"authForward":         spans["GET"].SpanID,
+		"authForward request": spans["authForward"].SpanID,
+		"upstream":            spans["authForward"].SpanID,
+	}
+	if len(spans) != len(parents) {
+		t.Fatalf("expected spans %v, got %v", parents, spans)
+	}
+	for name, parent := range parents {
+		if span := spans[name]; span.TraceID != traceID || span.ParentSpanID != parent {
+			t.Errorf("%s: expected child of %s in trace %s, got %+v", name, parent, traceID, span)
+		}
+	}
+	for traceparent, span := range map[string]exportedSpan{
+		authTraceparent:    spans["authForward request"],
+		backendTraceparent: spans["upstream"],
+	} {
+		if expected := "00-" + traceID + "-" + span.SpanID + "-01"; traceparent != expected {
+			t.Errorf("expected traceparent %s, got %s", expected, traceparent)
+		}
+	}
+}
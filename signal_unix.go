@@ -0,0 +1,33 @@
+//go:build !windows
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/plamorg/voltproxy/logging"
+)
+
+// handleLogSignals reopens the log files whenever SIGUSR1 is received, so that external tools such as logrotate
+// can move them, and toggles the debug log level whenever SIGUSR2 is received.
+func handleLogSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR2 {
+				level := logging.ToggleDebug()
+				slog.Info("Changed log level", slog.String("level", logging.LevelName(level)))
+				continue
+			}
+			if err := logging.ReopenFiles(); err != nil {
+				slog.Error("Error while reopening log files", slog.Any("error", err))
+				continue
+			}
+			slog.Info("Reopened log files")
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package main
+
+// handleLogSignals does nothing as there is no SIGUSR1 or SIGUSR2 on Windows.
+func handleLogSignals() {}
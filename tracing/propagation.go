@@ -0,0 +1,187 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// W3C trace context headers.
+const (
+	headerTraceparent = "traceparent"
+	headerTracestate  = "tracestate"
+)
+
+// traceparentVersion is the version of the traceparent header that is written.
+const traceparentVersion = "00"
+
+// invalidVersion is the version of the traceparent header that is forbidden.
+const invalidVersion = "ff"
+
+// flagSampled is the trace flag of sampled traces.
+const flagSampled = 0x01
+
+// Lengths of the version and flags fields of the traceparent header.
+const (
+	versionLength = 2
+	flagsLength   = 2
+)
+
+var errInvalidTraceparent = fmt.Errorf("invalid traceparent header")
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// String returns the trace ID in lowercase hexadecimal.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// String returns the span ID in lowercase hexadecimal.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid returns whether the trace ID is not all zeros.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// IsValid returns whether the span ID is not all zeros.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	_, _ = rand.Read(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	_, _ = rand.Read(s[:])
+	return s
+}
+
+// SpanContext identifies a span and carries the trace state propagated along with it.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid returns whether the span context has a trace ID and a span ID.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.IsValid() && c.SpanID.IsValid()
+}
+
+// traceparent returns the traceparent header of the span context.
+func (c SpanContext) traceparent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return traceparentVersion + "-" + c.TraceID.String() + "-" + c.SpanID.String() + "-" + flags
+}
+
+// decodeHex decodes a lowercase hexadecimal field of the traceparent header into dst.
+func decodeHex(dst []byte, field string) error {
+	if len(field) != 2*len(dst) || strings.ToLower(field) != field {
+		return errInvalidTraceparent
+	}
+	if _, err := hex.Decode(dst, []byte(field)); err != nil {
+		return errInvalidTraceparent
+	}
+	return nil
+}
+
+// parseTraceparent parses a traceparent header.
+// Headers of future versions are parsed as version 00, ignoring any additional fields.
+func parseTraceparent(header string) (SpanContext, error) {
+	fields := strings.Split(header, "-")
+	if len(fields) < 4 || len(fields[0]) != versionLength || fields[0] == invalidVersion ||
+		(fields[0] == traceparentVersion && len(fields) != 4) {
+		return SpanContext{}, fmt.Errorf("%w: %s", errInvalidTraceparent, header)
+	}
+	var c SpanContext
+	var version, flags [1]byte
+	if decodeHex(version[:], fields[0]) != nil ||
+		decodeHex(c.TraceID[:], fields[1]) != nil ||
+		decodeHex(c.SpanID[:], fields[2]) != nil ||
+		len(fields[3]) != flagsLength || decodeHex(flags[:], fields[3]) != nil ||
+		!c.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w: %s", errInvalidTraceparent, header)
+	}
+	c.Sampled = flags[0]&flagSampled != 0
+	return c, nil
+}
+
+type remoteKey struct{}
+
+// Extract returns a context with the span context of the traceparent and tracestate headers, if valid,
+// which becomes the parent of the next span started with the context.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	c, err := parseTraceparent(header.Get(headerTraceparent))
+	if err != nil {
+		return ctx
+	}
+	c.TraceState = strings.Join(header.Values(headerTracestate), ",")
+	return context.WithValue(ctx, remoteKey{}, c)
+}
+
+// Inject sets the traceparent and tracestate headers to the span context of the span of the context, if any.
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(headerTraceparent, span.ctx.traceparent())
+	if span.ctx.TraceState != "" {
+		header.Set(headerTracestate, span.ctx.TraceState)
+	} else {
+		header.Del(headerTracestate)
+	}
+}
+
+// Transport returns a http.RoundTripper that sends each request within a client span of the given name,
+// propagating its span context to the server.
+func Transport(name string, transport http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx, span := Start(req.Context(), name, KindClient)
+		if span == nil {
+			return transport.RoundTrip(req)
+		}
+		defer span.End()
+		req = req.Clone(ctx)
+		Inject(ctx, req.Header)
+		span.SetAttributes(
+			String("http.request.method", req.Method),
+			String("server.address", req.URL.Host),
+			String("url.full", req.URL.String()))
+
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		span.SetAttributes(Int("http.response.status_code", res.StatusCode))
+		if res.StatusCode >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%s", res.Status))
+		}
+		return res, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID      = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testSpanID + "-01"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	zeroTraceID, zeroSpanID := "00000000000000000000000000000000", "0000000000000000"
+	upperTraceID := strings.ToUpper(testTraceID)
+	tests := map[string]struct {
+		header      string
+		sampled     bool
+		expectedErr error
+	}{
+		"sampled":          {header: testTraceparent, sampled: true},
+		"not sampled":      {header: "00-" + testTraceID + "-" + testSpanID + "-00"},
+		"future version":   {header: "01-" + testTraceID + "-" + testSpanID + "-01-extra", sampled: true},
+		"empty":            {header: "", expectedErr: errInvalidTraceparent},
+		"forbidden":        {header: "ff-" + testTraceID + "-" + testSpanID + "-01", expectedErr: errInvalidTraceparent},
+		"extra field":      {header: testTraceparent + "-extra", expectedErr: errInvalidTraceparent},
+		"uppercase":        {header: "00-" + upperTraceID + "-" + testSpanID + "-01", expectedErr: errInvalidTraceparent},
+		"short trace ID":   {header: "00-4bf92f35-" + testSpanID + "-01", expectedErr: errInvalidTraceparent},
+		"zero trace ID":    {header: "00-" + zeroTraceID + "-" + testSpanID + "-01", expectedErr: errInvalidTraceparent},
+		"zero span ID":     {header: "00-" + testTraceID + "-" + zeroSpanID + "-01", expectedErr: errInvalidTraceparent},
+		"invalid flags":    {header: "00-" + testTraceID + "-" + testSpanID + "-0g", expectedErr: errInvalidTraceparent},
+		"invalid hex":      {header: "00-" + testTraceID + "-00f067aa0ba902bz-01", expectedErr: errInvalidTraceparent},
+		"long flags field": {header: "00-" + testTraceID + "-" + testSpanID + "-001", expectedErr: errInvalidTraceparent},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := parseTraceparent(test.header)
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected %v, got %v", test.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if c.TraceID.String() != testTraceID || c.SpanID.String() != testSpanID {
+				t.Errorf("expected %s and %s, got %s and %s", testTraceID, testSpanID, c.TraceID, c.SpanID)
+			}
+			if c.Sampled != test.sampled {
+				t.Errorf("expected sampled %v, got %v", test.sampled, c.Sampled)
+			}
+		})
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	tracer, _ := newTestTracer(t, 0)
+	header := http.Header{}
+	header.Set(headerTraceparent, testTraceparent)
+	header.Add(headerTracestate, "foo=1")
+	header.Add(headerTracestate, "bar=2")
+
+	ctx, span := tracer.Start(Extract(context.Background(), header), "test", KindServer)
+	out := http.Header{}
+	Inject(ctx, out)
+
+	expected := "00-" + testTraceID + "-" + span.SpanContext().SpanID.String() + "-01"
+	if got := out.Get(headerTraceparent); got != expected {
+		t.Errorf("expected traceparent %s, got %s", expected, got)
+	}
+	if got := out.Get(headerTracestate); got != "foo=1,bar=2" {
+		t.Errorf("expected tracestate %s, got %s", "foo=1,bar=2", got)
+	}
+	if span.parent.String() != testSpanID {
+		t.Errorf("expected parent %s, got %s", testSpanID, span.parent)
+	}
+
+	// Nothing is injected without a span.
+	out = http.Header{}
+	Inject(Extract(context.Background(), header), out)
+	if len(out) != 0 {
+		t.Errorf("expected no headers, got %v", out)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(headerTraceparent)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	tracer, _ := newTestTracer(t, 1)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", KindServer)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := defaultTracer.Swap(tracer)
+	defer defaultTracer.Store(previous)
+	res, err := (&http.Client{Transport: Transport("client", http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	c, err := parseTraceparent(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TraceID != parent.ctx.TraceID || c.SpanID == parent.ctx.SpanID {
+		t.Errorf("expected a child of %s, got %s", parent.ctx.traceparent(), received)
+	}
+	if req.Header.Get(headerTraceparent) != "" {
+		t.Errorf("expected the original request to be unchanged")
+	}
+
+	spans := tracer.exporter.spans
+	if len(spans) != 1 || spans[0].name != "client" || spans[0].err != "502 Bad Gateway" {
+		t.Errorf("expected a failed client span, got %+v", spans)
+	}
+}
@@ -0,0 +1,235 @@
+// Package tracing traces requests with spans that are propagated with the W3C trace context headers
+// and exported to an OpenTelemetry collector over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultServiceName    = "voltproxy"
+	defaultExportInterval = 5 * time.Second
+	defaultExportTimeout  = 10 * time.Second
+)
+
+var (
+	errMissingEndpoint   = fmt.Errorf("tracing requires an endpoint")
+	errInvalidSampleRate = fmt.Errorf("sample rate must be between 0 and 1")
+)
+
+// Config defines the configuration for tracing.
+type Config struct {
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint of the collector,
+	// e.g. http://localhost:4318/v1/traces.
+	Endpoint string `yaml:"endpoint"`
+	// Headers are sent with every export request, e.g. for authentication.
+	Headers map[string]string `yaml:"headers"`
+	// ServiceName is the service.name of the exported spans. Defaults to voltproxy.
+	ServiceName string `yaml:"serviceName"`
+	// SampleRate is the fraction of new traces that are sampled. Defaults to 1.
+	// Requests with a traceparent header follow the sampling decision of their parent.
+	SampleRate *float64 `yaml:"sampleRate"`
+	// Interval is how often spans are exported. Defaults to 5s.
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is the timeout of export requests. Defaults to 10s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Kind is the kind of a span.
+type Kind int
+
+// Span kinds, as defined by OTLP.
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Attribute is a key-value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Span is a timed operation within a trace. A nil span, started while tracing is disabled, does nothing.
+type Span struct {
+	tracer *Tracer
+	name   string
+	kind   Kind
+	ctx    SpanContext
+	parent SpanID
+	start  time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []Attribute
+	err        string
+	ended      bool
+}
+
+// SpanContext returns the span context of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil || !s.ctx.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// SetError marks the span as failed with the error.
+func (s *Span) SetError(err error) {
+	if s == nil || !s.ctx.Sampled || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span, which is then exported if it is sampled. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil || !s.ctx.Sampled {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, time.Now()
+	s.mu.Unlock()
+	s.tracer.exporter.enqueue(s)
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the span of the context, or nil if it has none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Tracer starts spans and exports those that are sampled.
+type Tracer struct {
+	sampleRate float64
+	exporter   *exporter
+	random     func() float64
+}
+
+// NewTracer creates a tracer with the given configuration, which exports spans until it is stopped.
+func NewTracer(c Config) (*Tracer, error) {
+	if c.Endpoint == "" {
+		return nil, errMissingEndpoint
+	}
+	sampleRate := c.sampleRate()
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("%w: got %v", errInvalidSampleRate, sampleRate)
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = defaultServiceName
+	}
+	if c.Interval == 0 {
+		c.Interval = defaultExportInterval
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultExportTimeout
+	}
+	t := &Tracer{sampleRate: sampleRate, exporter: newExporter(c), random: rand.Float64}
+	go t.exporter.run(c.Interval)
+	return t, nil
+}
+
+// Start starts a span that is a child of the span of the context, or of the remote span extracted into it.
+// A new trace is started, and sampled according to the sample rate, if there is no parent.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.ctx, span.parent = parent.ctx, parent.ctx.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		span.ctx, span.parent = remote, remote.SpanID
+	} else {
+		span.ctx = SpanContext{TraceID: newTraceID(), Sampled: t.random() < t.sampleRate}
+	}
+	span.ctx.SpanID = newSpanID()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Flush exports the spans that have ended.
+func (t *Tracer) Flush() error {
+	return t.exporter.flush()
+}
+
+// Stop stops exporting spans periodically, after exporting those that have ended.
+func (t *Tracer) Stop() {
+	t.exporter.stop()
+}
+
+// defaultTracer is the tracer set up by Initialize, if any.
+var defaultTracer atomic.Pointer[Tracer]
+
+// Initialize starts tracing with the configuration, replacing the previous tracer.
+// Tracing is disabled if the configuration is nil.
+func (c *Config) Initialize() error {
+	var t *Tracer
+	if c != nil {
+		var err error
+		if t, err = NewTracer(*c); err != nil {
+			return err
+		}
+	}
+	if previous := defaultTracer.Swap(t); previous != nil {
+		previous.Stop()
+	}
+	return nil
+}
+
+// Start starts a span with the tracer set up by Initialize.
+// If tracing is disabled, the context is returned unchanged along with a nil span.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	t := defaultTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	return t.Start(ctx, name, kind)
+}
+
+// sampleRate returns the sample rate of the configuration, which defaults to 1.
+func (c Config) sampleRate() float64 {
+	if c.SampleRate == nil {
+		return 1
+	}
+	return *c.SampleRate
+}
+
+// LogValue logs the configuration without its headers, which may hold credentials.
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("endpoint", c.Endpoint),
+		slog.String("serviceName", c.ServiceName),
+		slog.Float64("sampleRate", c.sampleRate()))
+}
@@ -0,0 +1,222 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is a stand-in for an OTLP/HTTP collector that records the exported spans.
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.requests = append(c.requests, req)
+		c.headers = append(c.headers, r.Header)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// spans returns the spans exported to the collector.
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var spans []otlpSpan
+	for _, req := range c.requests {
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				spans = append(spans, scopeSpans.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+// newTestTracer creates a tracer with the given sample rate that exports to a collector when flushed.
+func newTestTracer(t *testing.T, sampleRate float64) (*Tracer, *collector) {
+	t.Helper()
+	c := newCollector(t)
+	tracer, err := NewTracer(Config{
+		Endpoint:   c.URL,
+		Headers:    map[string]string{"Authorization": "Bearer secret"},
+		SampleRate: &sampleRate,
+		Interval:   time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tracer.Stop)
+	return tracer, c
+}
+
+func TestNewTracerErrors(t *testing.T) {
+	negative, tooHigh := -0.1, 1.5
+	endpoint := "http://collector"
+	tests := map[string]struct {
+		config   Config
+		expected error
+	}{
+		"missing endpoint":     {config: Config{}, expected: errMissingEndpoint},
+		"negative sample rate": {config: Config{Endpoint: endpoint, SampleRate: &negative}, expected: errInvalidSampleRate},
+		"sample rate above 1":  {config: Config{Endpoint: endpoint, SampleRate: &tooHigh}, expected: errInvalidSampleRate},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewTracer(test.config); !errors.Is(err, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestTracerSampling(t *testing.T) {
+	tracer, _ := newTestTracer(t, 0.5)
+	tests := map[string]struct {
+		random   float64
+		parent   string
+		expected bool
+	}{
+		"sampled":                {random: 0.2, expected: true},
+		"not sampled":            {random: 0.7, expected: false},
+		"sampled parent":         {random: 0.7, parent: testTraceparent, expected: true},
+		"parent is not sampled":  {random: 0.2, parent: "00-" + testTraceID + "-" + testSpanID + "-00", expected: false},
+		"invalid parent ignored": {random: 0.2, parent: "invalid", expected: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tracer.random = func() float64 { return test.random }
+			header := http.Header{}
+			header.Set(headerTraceparent, test.parent)
+			ctx, span := tracer.Start(Extract(context.Background(), header), "server", KindServer)
+			_, child := tracer.Start(ctx, "child", KindInternal)
+
+			if span.ctx.Sampled != test.expected || child.ctx.Sampled != test.expected {
+				t.Errorf("expected sampled %v, got %v and %v", test.expected, span.ctx.Sampled, child.ctx.Sampled)
+			}
+			if child.ctx.TraceID != span.ctx.TraceID || child.parent != span.ctx.SpanID {
+				t.Errorf("expected child of %s, got %s", span.ctx.traceparent(), child.ctx.traceparent())
+			}
+		})
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	tracer, c := newTestTracer(t, 1)
+	tracer.random = func() float64 { return 0 }
+
+	ctx, server := tracer.Start(context.Background(), "GET", KindServer)
+	server.SetAttributes(String("http.request.method", "GET"), Int("http.response.status_code", 503))
+	server.SetError(fmt.Errorf("503 Service Unavailable"))
+	_, client := tracer.Start(ctx, "upstream", KindClient)
+	client.End()
+	server.End()
+	server.End()
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	spans := c.spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected %d spans, got %d", 2, len(spans))
+	}
+	if auth := c.headers[0].Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("expected authorization header, got %s", auth)
+	}
+	resource := c.requests[0].ResourceSpans[0].Resource.Attributes[0]
+	if resource.Key != "service.name" || *resource.Value.StringValue != defaultServiceName {
+		t.Errorf("expected service name %s, got %+v", defaultServiceName, resource)
+	}
+
+	exportedClient, exportedServer := spans[0], spans[1]
+	if exportedClient.Name != "upstream" || exportedClient.Kind != KindClient ||
+		exportedClient.ParentSpanID != exportedServer.SpanID || exportedClient.TraceID != exportedServer.TraceID {
+		t.Errorf("expected client span child of the server span, got %+v", exportedClient)
+	}
+	if exportedServer.ParentSpanID != "" || exportedServer.Status.Code != statusError ||
+		exportedServer.Status.Message != "503 Service Unavailable" {
+		t.Errorf("expected failed root server span, got %+v", exportedServer)
+	}
+	if len(exportedServer.Attributes) != 2 || *exportedServer.Attributes[1].Value.IntValue != "503" {
+		t.Errorf("expected attributes, got %+v", exportedServer.Attributes)
+	}
+
+	// Spans that are not sampled are not exported.
+	tracer.random = func() float64 { return 1 }
+	_, span := tracer.Start(context.Background(), "GET", KindServer)
+	span.End()
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.spans()) != 2 {
+		t.Errorf("expected %d spans, got %d", 2, len(c.spans()))
+	}
+}
+
+func TestTracerExportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	tracer, err := NewTracer(Config{Endpoint: server.URL, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Stop()
+
+	_, span := tracer.Start(context.Background(), "GET", KindServer)
+	span.End()
+	if err := tracer.Flush(); !errors.Is(err, errExportFailed) {
+		t.Errorf("expected %v, got %v", errExportFailed, err)
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	c := newCollector(t)
+	config := &Config{Endpoint: c.URL, Interval: time.Hour}
+	if err := config.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "GET", KindServer)
+	span.End()
+
+	// Disabling tracing exports the remaining spans of the previous tracer.
+	if err := (*Config)(nil).Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.spans()) != 1 {
+		t.Errorf("expected %d spans, got %d", 1, len(c.spans()))
+	}
+	ctx := context.Background()
+	if got, span := Start(ctx, "GET", KindServer); got != ctx || span != nil {
+		t.Errorf("expected no span while tracing is disabled, got %v", span)
+	}
+	// A nil span does nothing.
+	span = nil
+	span.SetAttributes(String("key", "value"))
+	span.SetError(fmt.Errorf("error"))
+	span.End()
+}